@@ -0,0 +1,111 @@
+package appinfo
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// AndroidManifest : Information of AndroidManifest.xml in APK
+type AndroidManifest struct {
+	Package string
+	// LauncherActivity is the activity (or activity-alias) which has MAIN action and LAUNCHER category.
+	// It is empty when the app has no launcher activity
+	LauncherActivity string
+}
+
+// ErrNoLauncherActivity : Error returned when the manifest has no activity with MAIN action and LAUNCHER category
+var ErrNoLauncherActivity = errors.New("no activity with android.intent.action.MAIN and android.intent.category.LAUNCHER in AndroidManifest.xml")
+
+// ReadAndroidManifest : Read package name and launcher activity from binary AndroidManifest.xml in the APK
+func ReadAndroidManifest(apkPath string) (*AndroidManifest, error) {
+	data, err := readZipEntry(apkPath, "AndroidManifest.xml")
+	if err != nil {
+		return nil, err
+	}
+	root, err := ParseBinaryXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse AndroidManifest.xml: %s", err)
+	}
+	if root.Name != "manifest" {
+		return nil, fmt.Errorf("root element of AndroidManifest.xml is <%s>", root.Name)
+	}
+	manifest := &AndroidManifest{Package: root.Attrs["package"]}
+	if manifest.Package == "" {
+		return nil, errors.New("package is not found in AndroidManifest.xml")
+	}
+
+	for _, application := range root.Children {
+		if application.Name != "application" {
+			continue
+		}
+		for _, activity := range application.Children {
+			if activity.Name != "activity" && activity.Name != "activity-alias" {
+				continue
+			}
+			if activity.Attrs["enabled"] == "false" {
+				continue
+			}
+			if isLauncherActivity(activity) {
+				manifest.LauncherActivity = activity.Attrs["name"]
+				return manifest, nil
+			}
+		}
+	}
+	return manifest, nil
+}
+
+func isLauncherActivity(activity *XMLElement) bool {
+	for _, filter := range activity.Children {
+		if filter.Name != "intent-filter" {
+			continue
+		}
+		hasMain, hasLauncher := false, false
+		for _, child := range filter.Children {
+			switch {
+			case child.Name == "action" && child.Attrs["name"] == "android.intent.action.MAIN":
+				hasMain = true
+			case child.Name == "category" && child.Attrs["name"] == "android.intent.category.LAUNCHER":
+				hasLauncher = true
+			}
+		}
+		if hasMain && hasLauncher {
+			return true
+		}
+	}
+	return false
+}
+
+// AndroidPackageAndActivity : Package name and launcher activity of the APK.
+// The activity is returned as it is written in the manifest (e.g. `.MainActivity` or `com.example.MainActivity`)
+func AndroidPackageAndActivity(apkPath string) (string, string, error) {
+	manifest, err := ReadAndroidManifest(apkPath)
+	if err != nil {
+		return "", "", err
+	}
+	if manifest.LauncherActivity == "" {
+		return manifest.Package, "", ErrNoLauncherActivity
+	}
+	return manifest.Package, manifest.LauncherActivity, nil
+}
+
+func readZipEntry(zipPath, name string) ([]byte, error) {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid zip file: %s", zipPath, err)
+	}
+	defer reader.Close()
+	for _, file := range reader.File {
+		if strings.TrimPrefix(file.Name, "/") == name {
+			content, err := file.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer content.Close()
+			return ioutil.ReadAll(content)
+		}
+	}
+	return nil, fmt.Errorf("%s is not found in %s", name, zipPath)
+}
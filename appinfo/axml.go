@@ -0,0 +1,223 @@
+package appinfo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Chunk types of Android binary XML (frameworks/base/libs/androidfw/include/androidfw/ResourceTypes.h)
+const (
+	resStringPoolType      = 0x0001
+	resXMLType             = 0x0003
+	resXMLStartElementType = 0x0102
+	resXMLEndElementType   = 0x0103
+	resXMLResourceMapType  = 0x0180
+
+	stringPoolUTF8Flag = 1 << 8
+	noEntry            = 0xffffffff
+	typeString         = 0x03
+	typeIntBoolean     = 0x12
+)
+
+// Names of attributes whose names are stripped by obfuscators, looked up by their resource IDs
+var androidAttributeNames = map[uint32]string{
+	0x01010003: "name",
+	0x0101000e: "enabled",
+	0x01010010: "exported",
+}
+
+// XMLElement : Element of Android binary XML. Attrs are keyed by the local name without namespace (e.g. "name")
+type XMLElement struct {
+	Name     string
+	Attrs    map[string]string
+	Children []*XMLElement
+}
+
+// ParseBinaryXML : Parse Android binary XML such as AndroidManifest.xml in APK, and return the root element
+func ParseBinaryXML(data []byte) (*XMLElement, error) {
+	if len(data) < 8 || binary.LittleEndian.Uint16(data) != resXMLType {
+		return nil, errors.New("not an Android binary XML")
+	}
+	var strings []string
+	var resourceIDs []uint32
+	var root *XMLElement
+	stack := []*XMLElement{}
+
+	offset := int(binary.LittleEndian.Uint16(data[2:]))
+	for offset+8 <= len(data) {
+		chunkType := binary.LittleEndian.Uint16(data[offset:])
+		headerSize := int(binary.LittleEndian.Uint16(data[offset+2:]))
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if size < 8 || offset+size > len(data) || headerSize > size {
+			return nil, fmt.Errorf("broken chunk at offset %d", offset)
+		}
+		chunk := data[offset : offset+size]
+
+		switch chunkType {
+		case resStringPoolType:
+			var err error
+			if strings, err = parseStringPool(chunk); err != nil {
+				return nil, err
+			}
+		case resXMLResourceMapType:
+			for i := headerSize; i+4 <= size; i += 4 {
+				resourceIDs = append(resourceIDs, binary.LittleEndian.Uint32(chunk[i:]))
+			}
+		case resXMLStartElementType:
+			element, err := parseStartElement(chunk, headerSize, strings, resourceIDs)
+			if err != nil {
+				return nil, err
+			}
+			if len(stack) == 0 {
+				if root != nil {
+					return nil, errors.New("multiple root elements")
+				}
+				root = element
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, element)
+			}
+			stack = append(stack, element)
+		case resXMLEndElementType:
+			if len(stack) == 0 {
+				return nil, errors.New("unbalanced end element")
+			}
+			stack = stack[:len(stack)-1]
+		}
+		offset += size
+	}
+	if root == nil {
+		return nil, errors.New("no element in binary XML")
+	}
+	return root, nil
+}
+
+func parseStringPool(chunk []byte) ([]string, error) {
+	if len(chunk) < 28 {
+		return nil, errors.New("broken string pool")
+	}
+	count := int(binary.LittleEndian.Uint32(chunk[8:]))
+	flags := binary.LittleEndian.Uint32(chunk[16:])
+	stringsStart := int(binary.LittleEndian.Uint32(chunk[20:]))
+	headerSize := int(binary.LittleEndian.Uint16(chunk[2:]))
+	if headerSize+count*4 > len(chunk) || stringsStart > len(chunk) {
+		return nil, errors.New("broken string pool")
+	}
+
+	strings := make([]string, count)
+	for i := range strings {
+		start := stringsStart + int(binary.LittleEndian.Uint32(chunk[headerSize+i*4:]))
+		if start >= len(chunk) {
+			return nil, errors.New("broken string pool")
+		}
+		var err error
+		if flags&stringPoolUTF8Flag != 0 {
+			strings[i], err = decodeUTF8String(chunk[start:])
+		} else {
+			strings[i], err = decodeUTF16String(chunk[start:])
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return strings, nil
+}
+
+// UTF-8 strings are prefixed by UTF-16 length and UTF-8 length, each of which is 1 or 2 bytes
+func decodeUTF8String(b []byte) (string, error) {
+	pos := 0
+	readLength := func() int {
+		if pos >= len(b) {
+			return -1
+		}
+		length := int(b[pos])
+		pos++
+		if length&0x80 != 0 {
+			if pos >= len(b) {
+				return -1
+			}
+			length = (length&0x7f)<<8 | int(b[pos])
+			pos++
+		}
+		return length
+	}
+	readLength()
+	length := readLength()
+	if length < 0 || pos+length > len(b) {
+		return "", errors.New("broken UTF-8 string in string pool")
+	}
+	return string(b[pos : pos+length]), nil
+}
+
+// UTF-16 strings are prefixed by their length, which is 1 or 2 uint16
+func decodeUTF16String(b []byte) (string, error) {
+	if len(b) < 2 {
+		return "", errors.New("broken UTF-16 string in string pool")
+	}
+	pos := 2
+	length := int(binary.LittleEndian.Uint16(b))
+	if length&0x8000 != 0 {
+		if len(b) < 4 {
+			return "", errors.New("broken UTF-16 string in string pool")
+		}
+		length = (length&0x7fff)<<16 | int(binary.LittleEndian.Uint16(b[2:]))
+		pos = 4
+	}
+	if pos+length*2 > len(b) {
+		return "", errors.New("broken UTF-16 string in string pool")
+	}
+	units := make([]uint16, length)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[pos+i*2:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+func parseStartElement(chunk []byte, headerSize int, strings []string, resourceIDs []uint32) (*XMLElement, error) {
+	if headerSize+20 > len(chunk) {
+		return nil, errors.New("broken start element")
+	}
+	ext := chunk[headerSize:]
+	element := &XMLElement{Name: lookupString(strings, binary.LittleEndian.Uint32(ext[4:])), Attrs: map[string]string{}}
+	attributeStart := int(binary.LittleEndian.Uint16(ext[8:]))
+	attributeSize := int(binary.LittleEndian.Uint16(ext[10:]))
+	attributeCount := int(binary.LittleEndian.Uint16(ext[12:]))
+	if attributeSize < 20 || attributeStart+attributeCount*attributeSize > len(ext) {
+		return nil, errors.New("broken attributes of start element")
+	}
+
+	for i := 0; i < attributeCount; i++ {
+		attr := ext[attributeStart+i*attributeSize:]
+		nameIndex := binary.LittleEndian.Uint32(attr[4:])
+		name := lookupString(strings, nameIndex)
+		if int(nameIndex) < len(resourceIDs) {
+			if resourceName, ok := androidAttributeNames[resourceIDs[nameIndex]]; ok {
+				name = resourceName
+			}
+		}
+		rawValue := binary.LittleEndian.Uint32(attr[8:])
+		dataType := attr[15]
+		data := binary.LittleEndian.Uint32(attr[16:])
+		switch {
+		case rawValue != noEntry:
+			element.Attrs[name] = lookupString(strings, rawValue)
+		case dataType == typeString:
+			element.Attrs[name] = lookupString(strings, data)
+		case dataType == typeIntBoolean:
+			element.Attrs[name] = strconv.FormatBool(data != 0)
+		default:
+			element.Attrs[name] = fmt.Sprintf("0x%08x", data)
+		}
+	}
+	return element, nil
+}
+
+func lookupString(strings []string, index uint32) string {
+	if int(index) >= len(strings) || index == noEntry {
+		return ""
+	}
+	return strings[index]
+}
@@ -0,0 +1,320 @@
+package appinfo
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// Builds Android binary XML in the same layout as aapt2
+type axmlBuilder struct {
+	utf8        bool
+	strings     []string
+	resourceIDs []uint32
+	nodes       bytes.Buffer
+}
+
+type axmlAttr struct {
+	name  string
+	value interface{} // string, bool or uint32 (integer)
+}
+
+// The strings mapped to the resource IDs come first in the string pool, like the ones of android: attributes
+func newAXMLBuilder(utf8 bool, resourceNames map[string]uint32) *axmlBuilder {
+	builder := &axmlBuilder{utf8: utf8}
+	names := make([]string, 0, len(resourceNames))
+	for name := range resourceNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		builder.index(name)
+		builder.resourceIDs = append(builder.resourceIDs, resourceNames[name])
+	}
+	return builder
+}
+
+func (b *axmlBuilder) index(s string) uint32 {
+	for i, str := range b.strings {
+		if str == s {
+			return uint32(i)
+		}
+	}
+	b.strings = append(b.strings, s)
+	return uint32(len(b.strings) - 1)
+}
+
+func (b *axmlBuilder) start(name string, attrs ...axmlAttr) *axmlBuilder {
+	ext := &bytes.Buffer{}
+	write(ext, uint32(noEntry), b.index(name), uint16(20), uint16(20), uint16(len(attrs)), uint16(0), uint16(0), uint16(0))
+	for _, attr := range attrs {
+		switch value := attr.value.(type) {
+		case string:
+			write(ext, uint32(noEntry), b.index(attr.name), b.index(value), uint16(8), uint8(0), uint8(typeString), b.index(value))
+		case bool:
+			data := uint32(0)
+			if value {
+				data = noEntry
+			}
+			write(ext, uint32(noEntry), b.index(attr.name), uint32(noEntry), uint16(8), uint8(0), uint8(typeIntBoolean), data)
+		case uint32:
+			write(ext, uint32(noEntry), b.index(attr.name), uint32(noEntry), uint16(8), uint8(0), uint8(0x10), value)
+		}
+	}
+	write(&b.nodes, uint16(resXMLStartElementType), uint16(16), uint32(16+ext.Len()), uint32(1), uint32(noEntry))
+	b.nodes.Write(ext.Bytes())
+	return b
+}
+
+func (b *axmlBuilder) end(name string) *axmlBuilder {
+	write(&b.nodes, uint16(resXMLEndElementType), uint16(16), uint32(24), uint32(1), uint32(noEntry), uint32(noEntry), b.index(name))
+	return b
+}
+
+func (b *axmlBuilder) bytes() []byte {
+	var data, offsets bytes.Buffer
+	for _, s := range b.strings {
+		write(&offsets, uint32(data.Len()))
+		if b.utf8 {
+			writeUTF8Length(&data, len(utf16.Encode([]rune(s))))
+			writeUTF8Length(&data, len(s))
+			data.WriteString(s)
+			data.WriteByte(0)
+		} else {
+			units := utf16.Encode([]rune(s))
+			write(&data, uint16(len(units)), units, uint16(0))
+		}
+	}
+	for data.Len()%4 != 0 {
+		data.WriteByte(0)
+	}
+	flags := uint32(0)
+	if b.utf8 {
+		flags = stringPoolUTF8Flag
+	}
+	body := &bytes.Buffer{}
+	poolSize := 28 + offsets.Len() + data.Len()
+	write(body, uint16(resStringPoolType), uint16(28), uint32(poolSize), uint32(len(b.strings)), uint32(0), flags, uint32(28+offsets.Len()), uint32(0))
+	body.Write(offsets.Bytes())
+	body.Write(data.Bytes())
+	write(body, uint16(resXMLResourceMapType), uint16(8), uint32(8+4*len(b.resourceIDs)), b.resourceIDs)
+	body.Write(b.nodes.Bytes())
+
+	file := &bytes.Buffer{}
+	write(file, uint16(resXMLType), uint16(8), uint32(8+body.Len()))
+	file.Write(body.Bytes())
+	return file.Bytes()
+}
+
+func writeUTF8Length(buffer *bytes.Buffer, length int) {
+	if length > 0x7f {
+		buffer.WriteByte(byte(0x80 | length>>8))
+	}
+	buffer.WriteByte(byte(length))
+}
+
+func write(buffer *bytes.Buffer, values ...interface{}) {
+	for _, value := range values {
+		binary.Write(buffer, binary.LittleEndian, value)
+	}
+}
+
+var androidResourceNames = map[string]uint32{"name": 0x01010003, "enabled": 0x0101000e}
+
+// Manifest of an app whose launcher is .MainActivity, after an activity without LAUNCHER and a disabled launcher alias
+func launcherManifest(utf8 bool) []byte {
+	b := newAXMLBuilder(utf8, androidResourceNames)
+	b.start("manifest", axmlAttr{"package", "com.example.app"}, axmlAttr{"versionCode", uint32(28)}).start("application")
+	for _, activity := range []struct {
+		element  string
+		attrs    []axmlAttr
+		category string
+	}{
+		{"activity", []axmlAttr{{"name", ".Other"}}, "android.intent.category.DEFAULT"},
+		{"activity-alias", []axmlAttr{{"name", ".Alias"}, {"enabled", false}}, "android.intent.category.LAUNCHER"},
+		{"activity", []axmlAttr{{"name", ".MainActivity"}, {"exported", true}}, "android.intent.category.LAUNCHER"},
+	} {
+		b.start(activity.element, activity.attrs...).start("intent-filter").
+			start("action", axmlAttr{"name", "android.intent.action.MAIN"}).end("action").
+			start("category", axmlAttr{"name", activity.category}).end("category").
+			end("intent-filter").end(activity.element)
+	}
+	return b.end("application").end("manifest").bytes()
+}
+
+func TestParseBinaryXML(t *testing.T) {
+	for _, utf8 := range []bool{false, true} {
+		root, err := ParseBinaryXML(launcherManifest(utf8))
+		if err != nil {
+			t.Fatalf("utf8=%v: ParseBinaryXML() error = %v", utf8, err)
+		}
+		wantAttrs := map[string]string{"package": "com.example.app", "versionCode": "0x0000001c"}
+		if root.Name != "manifest" || !reflect.DeepEqual(root.Attrs, wantAttrs) {
+			t.Errorf("utf8=%v: root = <%s %v>", utf8, root.Name, root.Attrs)
+		}
+		activities := root.Children[0].Children
+		if len(activities) != 3 {
+			t.Fatalf("utf8=%v: %d activities, want 3", utf8, len(activities))
+		}
+		if attrs := activities[1].Attrs; attrs["name"] != ".Alias" || attrs["enabled"] != "false" {
+			t.Errorf("utf8=%v: alias attrs = %v", utf8, attrs)
+		}
+		if attrs := activities[2].Attrs; attrs["exported"] != "true" {
+			t.Errorf("utf8=%v: activity attrs = %v", utf8, attrs)
+		}
+		category := activities[2].Children[0].Children[1]
+		if category.Name != "category" || category.Attrs["name"] != "android.intent.category.LAUNCHER" {
+			t.Errorf("utf8=%v: category = <%s %v>", utf8, category.Name, category.Attrs)
+		}
+	}
+}
+
+func TestParseBinaryXMLStrings(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	for _, utf8 := range []bool{false, true} {
+		for _, value := range []string{"", "日本語", long} {
+			data := newAXMLBuilder(utf8, nil).start("manifest", axmlAttr{"package", value}).end("manifest").bytes()
+			root, err := ParseBinaryXML(data)
+			if err != nil {
+				t.Fatalf("utf8=%v: ParseBinaryXML() error = %v", utf8, err)
+			}
+			if root.Attrs["package"] != value {
+				t.Errorf("utf8=%v: package = %q, want %q", utf8, root.Attrs["package"], value)
+			}
+		}
+	}
+}
+
+// Obfuscators strip the names of android: attributes, which are then told by their resource IDs
+func TestParseBinaryXMLObfuscatedAttributes(t *testing.T) {
+	data := newAXMLBuilder(false, map[string]uint32{"a": 0x01010003, "b": 0x0101000e}).
+		start("activity", axmlAttr{"a", ".MainActivity"}, axmlAttr{"b", true}).end("activity").bytes()
+	root, err := ParseBinaryXML(data)
+	if err != nil {
+		t.Fatalf("ParseBinaryXML() error = %v", err)
+	}
+	if want := map[string]string{"name": ".MainActivity", "enabled": "true"}; !reflect.DeepEqual(root.Attrs, want) {
+		t.Errorf("attrs = %v, want %v", root.Attrs, want)
+	}
+}
+
+func TestParseBinaryXMLErrors(t *testing.T) {
+	valid := launcherManifest(false)
+	withUint32 := func(offset int, value uint32) []byte {
+		data := append([]byte{}, valid...)
+		binary.LittleEndian.PutUint32(data[offset:], value)
+		return data
+	}
+	element := func(build func(b *axmlBuilder)) []byte {
+		b := newAXMLBuilder(false, nil)
+		build(b)
+		return b.bytes()
+	}
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "not an Android binary XML"},
+		{"text XML", []byte("<manifest package=\"com.example.app\"/>"), "not an Android binary XML"},
+		{"broken chunk size", withUint32(12, 4), "broken chunk at offset 8"},
+		{"chunk larger than file", withUint32(12, uint32(len(valid))), "broken chunk at offset 8"},
+		{"string count larger than pool", withUint32(16, 1<<20), "broken string pool"},
+		{"strings start out of pool", withUint32(28, 1<<20), "broken string pool"},
+		{"no element", newAXMLBuilder(false, nil).bytes(), "no element"},
+		{"unbalanced end element", element(func(b *axmlBuilder) { b.end("manifest") }), "unbalanced end element"},
+		{"multiple roots", element(func(b *axmlBuilder) { b.start("a").end("a").start("b").end("b") }), "multiple root elements"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseBinaryXML(test.data)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ParseBinaryXML() error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+// Broken files must be reported as errors, not panics
+func TestParseBinaryXMLDoesNotPanic(t *testing.T) {
+	for _, utf8 := range []bool{false, true} {
+		data := launcherManifest(utf8)
+		for i := range data {
+			ParseBinaryXML(data[:i])
+			for _, b := range []byte{0x00, 0x7f, 0xff} {
+				corrupt := append([]byte{}, data...)
+				corrupt[i] = b
+				ParseBinaryXML(corrupt)
+			}
+		}
+	}
+}
+
+func writeAPK(t *testing.T, entries map[string][]byte) string {
+	path := filepath.Join(t.TempDir(), "app.apk")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	writer := zip.NewWriter(file)
+	for name, content := range entries {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Write(content)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAndroidPackageAndActivity(t *testing.T) {
+	noLauncher := newAXMLBuilder(false, androidResourceNames).
+		start("manifest", axmlAttr{"package", "com.example.app"}).start("application").end("application").end("manifest").bytes()
+	noPackage := newAXMLBuilder(false, androidResourceNames).start("manifest").end("manifest").bytes()
+	notManifest := newAXMLBuilder(false, androidResourceNames).start("resources").end("resources").bytes()
+	tests := []struct {
+		name     string
+		entries  map[string][]byte
+		pkg      string
+		activity string
+		err      string
+	}{
+		{"launcher activity", map[string][]byte{"AndroidManifest.xml": launcherManifest(false)}, "com.example.app", ".MainActivity", ""},
+		{"no launcher activity", map[string][]byte{"AndroidManifest.xml": noLauncher}, "com.example.app", "", ErrNoLauncherActivity.Error()},
+		{"no package", map[string][]byte{"AndroidManifest.xml": noPackage}, "", "", "package is not found"},
+		{"not manifest", map[string][]byte{"AndroidManifest.xml": notManifest}, "", "", "root element of AndroidManifest.xml is <resources>"},
+		{"broken manifest", map[string][]byte{"AndroidManifest.xml": []byte("broken")}, "", "", "failed to parse AndroidManifest.xml"},
+		{"no manifest", map[string][]byte{"classes.dex": {}}, "", "", "AndroidManifest.xml is not found"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pkg, activity, err := AndroidPackageAndActivity(writeAPK(t, test.entries))
+			if pkg != test.pkg || activity != test.activity {
+				t.Errorf("AndroidPackageAndActivity() = %q, %q, want %q, %q", pkg, activity, test.pkg, test.activity)
+			}
+			if (err == nil) != (test.err == "") || (err != nil && !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("AndroidPackageAndActivity() error = %v, want %q", err, test.err)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "app.apk")
+	if err := ioutil.WriteFile(path, []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := AndroidPackageAndActivity(path); err == nil || !strings.Contains(err.Error(), "is not a valid zip file") {
+		t.Errorf("AndroidPackageAndActivity() error = %v, want invalid zip", err)
+	}
+}
@@ -0,0 +1,131 @@
+package appinfo
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadIOSInfoPlist : Read Info.plist of the app, which is either of `.app` directory or `.ipa` file
+func ReadIOSInfoPlist(appPath string) (map[string]interface{}, error) {
+	var data []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(strings.TrimRight(appPath, "/"))) {
+	case ".app":
+		data, err = ioutil.ReadFile(filepath.Join(appPath, "Info.plist"))
+	case ".ipa":
+		data, err = readIPAInfoPlist(appPath)
+	default:
+		return nil, fmt.Errorf("%s is neither .app directory nor .ipa file", appPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	plist, err := ParsePlist(data)
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := plist.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("Info.plist is not a dictionary")
+	}
+	return dict, nil
+}
+
+// Reads Payload/<name>.app/Info.plist in the IPA
+func readIPAInfoPlist(ipaPath string) ([]byte, error) {
+	reader, err := zip.OpenReader(ipaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	appDir, err := ipaAppDir(reader, ipaPath)
+	if err != nil {
+		return nil, err
+	}
+	content, err := openZipFile(reader, appDir+"Info.plist")
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+	return ioutil.ReadAll(content)
+}
+
+// Finds Payload/<name>.app/ directory in the IPA
+func ipaAppDir(reader *zip.ReadCloser, ipaPath string) (string, error) {
+	for _, file := range reader.File {
+		segments := strings.Split(file.Name, "/")
+		if len(segments) == 3 && segments[0] == "Payload" && strings.HasSuffix(segments[1], ".app") && segments[2] == "Info.plist" {
+			return segments[0] + "/" + segments[1] + "/", nil
+		}
+	}
+	return "", fmt.Errorf("Payload/*.app/Info.plist is not found in %s", ipaPath)
+}
+
+func openZipFile(reader *zip.ReadCloser, name string) (io.ReadCloser, error) {
+	for _, file := range reader.File {
+		if file.Name == name {
+			return file.Open()
+		}
+	}
+	return nil, fmt.Errorf("%s is not found", name)
+}
+
+// IOSExecutableSlices : Architectures and platforms of the main executable (CFBundleExecutable) of the app,
+// which is either of `.app` directory or `.ipa` file
+func IOSExecutableSlices(appPath string) ([]MachOSlice, error) {
+	plist, err := ReadIOSInfoPlist(appPath)
+	if err != nil {
+		return nil, err
+	}
+	executable, ok := plist["CFBundleExecutable"].(string)
+	if !ok || executable == "" {
+		return nil, errors.New("CFBundleExecutable is not found in Info.plist")
+	}
+
+	var content io.ReadCloser
+	if strings.ToLower(filepath.Ext(strings.TrimRight(appPath, "/"))) == ".ipa" {
+		reader, err := zip.OpenReader(appPath)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		appDir, err := ipaAppDir(reader, appPath)
+		if err != nil {
+			return nil, err
+		}
+		if content, err = openZipFile(reader, appDir+executable); err != nil {
+			return nil, err
+		}
+	} else if content, err = os.Open(filepath.Join(appPath, executable)); err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	slices, err := ReadMachO(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read executable %s: %s", executable, err)
+	}
+	return slices, nil
+}
+
+// IOSBundleID : CFBundleIdentifier of the app, which is either of `.app` directory or `.ipa` file
+func IOSBundleID(appPath string) (string, error) {
+	if _, err := os.Stat(appPath); err != nil {
+		return "", err
+	}
+	plist, err := ReadIOSInfoPlist(appPath)
+	if err != nil {
+		return "", err
+	}
+	bundleID, ok := plist["CFBundleIdentifier"].(string)
+	if !ok || bundleID == "" {
+		return "", errors.New("CFBundleIdentifier is not found in Info.plist")
+	}
+	return bundleID, nil
+}
@@ -0,0 +1,200 @@
+package appinfo
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// Mach-O format: https://opensource.apple.com/source/xnu/xnu-6153.141.1/EXTERNAL_HEADERS/mach-o/loader.h
+const (
+	machOMagic32 = 0xfeedface
+	machOMagic64 = 0xfeedfacf
+	fatMagic     = 0xcafebabe
+	fatMagic64   = 0xcafebabf
+
+	lcVersionMinMacOSX   = 0x24
+	lcVersionMinIPhoneOS = 0x25
+	lcVersionMinTVOS     = 0x2f
+	lcVersionMinWatchOS  = 0x30
+	lcBuildVersion       = 0x32
+
+	// Load commands larger than this are treated as broken
+	maxLoadCommandsSize = 16 << 20
+)
+
+// Platforms in LC_BUILD_VERSION
+var machOPlatforms = map[uint32]string{
+	1:  "macos",
+	2:  "ios",
+	3:  "tvos",
+	4:  "watchos",
+	5:  "bridgeos",
+	6:  "maccatalyst",
+	7:  "ios-simulator",
+	8:  "tvos-simulator",
+	9:  "watchos-simulator",
+	10: "driverkit",
+	11: "visionos",
+	12: "visionos-simulator",
+}
+
+var machOCPUTypes = map[uint32]string{
+	7:          "i386",
+	0x01000007: "x86_64",
+	12:         "armv7",
+	0x0100000c: "arm64",
+	0x0200000c: "arm64_32",
+}
+
+// MachOSlice : Architecture and platform of a Mach-O binary. Fat binaries have one slice per architecture
+type MachOSlice struct {
+	Arch     string
+	Platform string
+}
+
+// ReadMachO : Read the architectures and platforms of the Mach-O binary.
+// The reader is consumed sequentially, so a file in a zip archive can be read without extracting it
+func ReadMachO(r io.Reader) ([]MachOSlice, error) {
+	reader := &offsetReader{reader: bufio.NewReader(r)}
+	var magic [4]byte
+	if _, err := io.ReadFull(reader, magic[:]); err != nil {
+		return nil, errors.New("not a Mach-O binary")
+	}
+
+	switch binary.BigEndian.Uint32(magic[:]) {
+	case fatMagic, fatMagic64:
+		is64 := binary.BigEndian.Uint32(magic[:]) == fatMagic64
+		var count uint32
+		if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
+			return nil, err
+		}
+		if count == 0 || count > 64 {
+			return nil, fmt.Errorf("invalid number of architectures %d in fat Mach-O binary", count)
+		}
+		offsets := make([]int64, count)
+		for i := range offsets {
+			entry := make([]byte, 20)
+			if is64 {
+				entry = make([]byte, 32)
+			}
+			if _, err := io.ReadFull(reader, entry); err != nil {
+				return nil, err
+			}
+			if is64 {
+				offsets[i] = int64(binary.BigEndian.Uint64(entry[8:]))
+			} else {
+				offsets[i] = int64(binary.BigEndian.Uint32(entry[8:]))
+			}
+		}
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+		slices := []MachOSlice{}
+		for _, offset := range offsets {
+			if offset < reader.offset {
+				return nil, errors.New("overlapping architectures in fat Mach-O binary")
+			}
+			if _, err := io.CopyN(ioutil.Discard, reader, offset-reader.offset); err != nil {
+				return nil, err
+			}
+			if _, err := io.ReadFull(reader, magic[:]); err != nil {
+				return nil, err
+			}
+			slice, err := readMachOSlice(reader, magic)
+			if err != nil {
+				return nil, err
+			}
+			slices = append(slices, *slice)
+		}
+		return slices, nil
+	default:
+		slice, err := readMachOSlice(reader, magic)
+		if err != nil {
+			return nil, err
+		}
+		return []MachOSlice{*slice}, nil
+	}
+}
+
+// Reads the header and load commands of a thin Mach-O binary following the magic
+func readMachOSlice(r io.Reader, magic [4]byte) (*MachOSlice, error) {
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint32(magic[:]) == machOMagic32 || binary.LittleEndian.Uint32(magic[:]) == machOMagic64:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(magic[:]) == machOMagic32 || binary.BigEndian.Uint32(magic[:]) == machOMagic64:
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("not a Mach-O binary")
+	}
+	headerSize := 24
+	if order.Uint32(magic[:]) == machOMagic64 {
+		headerSize = 28
+	}
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	cpuType := order.Uint32(header[0:])
+	commandCount := order.Uint32(header[12:])
+	commandsSize := order.Uint32(header[16:])
+	if commandsSize > maxLoadCommandsSize {
+		return nil, errors.New("load commands of Mach-O binary are too large")
+	}
+	commands := make([]byte, commandsSize)
+	if _, err := io.ReadFull(r, commands); err != nil {
+		return nil, err
+	}
+
+	slice := &MachOSlice{Arch: machOCPUTypes[cpuType]}
+	if slice.Arch == "" {
+		slice.Arch = fmt.Sprintf("cpu-0x%x", cpuType)
+	}
+	for i, offset := uint32(0), uint32(0); i < commandCount && offset+8 <= commandsSize; i++ {
+		command := order.Uint32(commands[offset:])
+		size := order.Uint32(commands[offset+4:])
+		// offset+size can overflow, while commandsSize-offset cannot because of the loop condition
+		if size < 8 || size > commandsSize-offset {
+			return nil, errors.New("broken load command in Mach-O binary")
+		}
+		switch command {
+		case lcBuildVersion:
+			if size >= 12 {
+				slice.Platform = machOPlatforms[order.Uint32(commands[offset+8:])]
+			}
+		case lcVersionMinIPhoneOS:
+			// Old simulator binaries have no LC_BUILD_VERSION, and are distinguished only by the architecture
+			if slice.Arch == "x86_64" || slice.Arch == "i386" {
+				slice.Platform = "ios-simulator"
+			} else {
+				slice.Platform = "ios"
+			}
+		case lcVersionMinMacOSX:
+			slice.Platform = "macos"
+		case lcVersionMinTVOS:
+			slice.Platform = "tvos"
+		case lcVersionMinWatchOS:
+			slice.Platform = "watchos"
+		}
+		if slice.Platform != "" {
+			break
+		}
+		offset += size
+	}
+	return slice, nil
+}
+
+type offsetReader struct {
+	reader io.Reader
+	offset int64
+}
+
+func (r *offsetReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
@@ -0,0 +1,240 @@
+package appinfo
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	cpuARM64  = 0x0100000c
+	cpuX86_64 = 0x01000007
+	cpuARMv7  = 12
+)
+
+// Thin Mach-O binary with LC_SEGMENT_64 followed by the load command of the platform
+type machOBinary struct {
+	order   binary.ByteOrder
+	is64    bool
+	cpuType uint32
+	command uint32 // lcBuildVersion or one of lcVersionMin*
+	// platform of LC_BUILD_VERSION
+	platform uint32
+}
+
+func (m machOBinary) bytes() []byte {
+	order := m.order
+	if order == nil {
+		order = binary.LittleEndian
+	}
+	commands := &bytes.Buffer{}
+	binary.Write(commands, order, []uint32{0x19, 72})
+	commands.Write(make([]byte, 64))
+	if m.command == lcBuildVersion {
+		binary.Write(commands, order, []uint32{lcBuildVersion, 24, m.platform, 0x000e0000, 0x000e0000, 0})
+	} else {
+		binary.Write(commands, order, []uint32{m.command, 16, 0x000c0000, 0x000c0000})
+	}
+
+	data := &bytes.Buffer{}
+	magic := uint32(machOMagic32)
+	if m.is64 {
+		magic = machOMagic64
+	}
+	binary.Write(data, order, []uint32{magic, m.cpuType, 0, 2, 2, uint32(commands.Len()), 0})
+	if m.is64 {
+		binary.Write(data, order, uint32(0))
+	}
+	data.Write(commands.Bytes())
+	data.Write(make([]byte, 100))
+	return data.Bytes()
+}
+
+// Fat binary whose slices are aligned to 4096 bytes. The slices are listed in the header in reverse order,
+// because the order of the header does not have to match the order in the file
+func fatBinary(is64 bool, slices ...[]byte) []byte {
+	header := &bytes.Buffer{}
+	magic := uint32(fatMagic)
+	if is64 {
+		magic = fatMagic64
+	}
+	binary.Write(header, binary.BigEndian, []uint32{magic, uint32(len(slices))})
+	offsets := make([]int, len(slices))
+	offset := 4096
+	for i, slice := range slices {
+		offsets[i] = offset
+		offset += (len(slice) + 4095) / 4096 * 4096
+	}
+	for i := len(slices) - 1; i >= 0; i-- {
+		if is64 {
+			binary.Write(header, binary.BigEndian, []uint32{0, 0})
+			binary.Write(header, binary.BigEndian, []uint64{uint64(offsets[i]), uint64(len(slices[i]))})
+			binary.Write(header, binary.BigEndian, []uint32{12, 0})
+		} else {
+			binary.Write(header, binary.BigEndian, []uint32{0, 0, uint32(offsets[i]), uint32(len(slices[i])), 12})
+		}
+	}
+	data := make([]byte, offset)
+	copy(data, header.Bytes())
+	for i, slice := range slices {
+		copy(data[offsets[i]:], slice)
+	}
+	return data
+}
+
+func TestReadMachO(t *testing.T) {
+	simulator := machOBinary{is64: true, cpuType: cpuARM64, command: lcBuildVersion, platform: 7}.bytes()
+	oldSimulator := machOBinary{is64: true, cpuType: cpuX86_64, command: lcVersionMinIPhoneOS}.bytes()
+	tests := []struct {
+		name   string
+		data   []byte
+		slices []MachOSlice
+	}{
+		{"simulator", simulator, []MachOSlice{{"arm64", "ios-simulator"}}},
+		{"device", machOBinary{is64: true, cpuType: cpuARM64, command: lcBuildVersion, platform: 2}.bytes(), []MachOSlice{{"arm64", "ios"}}},
+		{"macOS", machOBinary{is64: true, cpuType: cpuX86_64, command: lcBuildVersion, platform: 1}.bytes(), []MachOSlice{{"x86_64", "macos"}}},
+		{"old simulator", oldSimulator, []MachOSlice{{"x86_64", "ios-simulator"}}},
+		{"old 32-bit device", machOBinary{cpuType: cpuARMv7, command: lcVersionMinIPhoneOS}.bytes(), []MachOSlice{{"armv7", "ios"}}},
+		{"big endian", machOBinary{order: binary.BigEndian, cpuType: cpuARMv7, command: lcVersionMinTVOS}.bytes(), []MachOSlice{{"armv7", "tvos"}}},
+		{"unknown CPU", machOBinary{is64: true, cpuType: 0x99, command: lcVersionMinWatchOS}.bytes(), []MachOSlice{{"cpu-0x99", "watchos"}}},
+		{"fat", fatBinary(false, oldSimulator, simulator), []MachOSlice{{"x86_64", "ios-simulator"}, {"arm64", "ios-simulator"}}},
+		{"fat64", fatBinary(true, simulator, oldSimulator), []MachOSlice{{"arm64", "ios-simulator"}, {"x86_64", "ios-simulator"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			slices, err := ReadMachO(bytes.NewReader(test.data))
+			if err != nil {
+				t.Fatalf("ReadMachO() error = %v", err)
+			}
+			if !reflect.DeepEqual(slices, test.slices) {
+				t.Errorf("ReadMachO() = %v, want %v", slices, test.slices)
+			}
+		})
+	}
+}
+
+func TestReadMachOErrors(t *testing.T) {
+	thin := machOBinary{is64: true, cpuType: cpuARM64, command: lcBuildVersion, platform: 7}.bytes()
+	fat := fatBinary(false, thin, thin)
+	withUint32 := func(data []byte, order binary.ByteOrder, offset int, value uint32) []byte {
+		data = append([]byte{}, data...)
+		order.PutUint32(data[offset:], value)
+		return data
+	}
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", nil, "not a Mach-O binary"},
+		{"shell script", []byte("#!/bin/sh\necho hello\n"), "not a Mach-O binary"},
+		{"truncated header", thin[:20], "EOF"},
+		{"truncated load commands", thin[:40], "EOF"},
+		{"too large load commands", withUint32(thin, binary.LittleEndian, 20, maxLoadCommandsSize+1), "too large"},
+		{"broken load command size", withUint32(thin, binary.LittleEndian, 36, 4), "broken load command"},
+		{"load command out of range", withUint32(thin, binary.LittleEndian, 36, 1000), "broken load command"},
+		// The second load command ends at 4 when the end is calculated in uint32
+		{"load command size overflow", withUint32(withUint32(withUint32(thin, binary.LittleEndian, 16, 2), binary.LittleEndian, 36, 8),
+			binary.LittleEndian, 44, 0xFFFFFFFC), "broken load command"},
+		{"no architecture", withUint32(fat, binary.BigEndian, 4, 0), "invalid number of architectures 0"},
+		{"too many architectures", withUint32(fat, binary.BigEndian, 4, 1000), "invalid number of architectures 1000"},
+		{"overlapping architectures", withUint32(fat, binary.BigEndian, 16, 4096), "overlapping architectures"},
+		{"architecture out of file", withUint32(fat, binary.BigEndian, 16, 1<<20), "EOF"},
+		{"truncated fat header", fat[:12], "EOF"},
+		{"truncated slice", fat[:4096+16], "EOF"},
+		{"slice is not Mach-O", withUint32(fat, binary.BigEndian, 4096, 0), "not a Mach-O binary"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadMachO(bytes.NewReader(test.data))
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ReadMachO() error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+// Broken files must be reported as errors, not panics
+func TestReadMachODoesNotPanic(t *testing.T) {
+	thin := machOBinary{is64: true, cpuType: cpuARM64, command: lcBuildVersion, platform: 7}.bytes()
+	// The header of the fat binary is enough since the slices are aligned to 4096 bytes
+	for _, data := range [][]byte{thin, fatBinary(true, thin, thin)[:64]} {
+		for i := range data {
+			ReadMachO(bytes.NewReader(data[:i]))
+			for _, b := range []byte{0x00, 0x7f, 0xff} {
+				corrupt := append([]byte{}, data...)
+				corrupt[i] = b
+				ReadMachO(bytes.NewReader(corrupt))
+			}
+		}
+	}
+}
+
+const executableInfoPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>CFBundleIdentifier</key>
+	<string>com.example.app</string>
+	<key>CFBundleExecutable</key>
+	<string>Example</string>
+</dict>
+</plist>`
+
+func TestIOSExecutableSlices(t *testing.T) {
+	executable := fatBinary(false,
+		machOBinary{is64: true, cpuType: cpuX86_64, command: lcBuildVersion, platform: 7}.bytes(),
+		machOBinary{is64: true, cpuType: cpuARM64, command: lcBuildVersion, platform: 7}.bytes())
+	want := []MachOSlice{{"x86_64", "ios-simulator"}, {"arm64", "ios-simulator"}}
+	dir := t.TempDir()
+
+	appPath := filepath.Join(dir, "Example.app")
+	if err := os.Mkdir(appPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string][]byte{"Info.plist": []byte(executableInfoPlist), "Example": executable} {
+		if err := ioutil.WriteFile(filepath.Join(appPath, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ipaPath := filepath.Join(dir, "Example.ipa")
+	file, err := os.Create(ipaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := zip.NewWriter(file)
+	for name, content := range map[string][]byte{"Info.plist": []byte(executableInfoPlist), "Example": executable} {
+		entry, err := writer.Create("Payload/Example.app/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Write(content)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	for _, path := range []string{appPath, ipaPath} {
+		slices, err := IOSExecutableSlices(path)
+		if err != nil {
+			t.Fatalf("IOSExecutableSlices(%s) error = %v", filepath.Base(path), err)
+		}
+		if !reflect.DeepEqual(slices, want) {
+			t.Errorf("IOSExecutableSlices(%s) = %v, want %v", filepath.Base(path), slices, want)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(appPath, "Example"), []byte("#!/bin/sh"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := IOSExecutableSlices(appPath); err == nil || !strings.Contains(err.Error(), "failed to read executable Example") {
+		t.Errorf("IOSExecutableSlices() error = %v, want failure of the executable", err)
+	}
+}
@@ -0,0 +1,308 @@
+// Package appinfo reads information of iOS and Android app artifacts (e.g. bundle ID) without platform tools like Xcode,
+// so that it works on any OS.
+package appinfo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// ParsePlist : Parse XML or binary property list. Values are returned as map[string]interface{}, []interface{},
+// string, int64, float64, bool, time.Time or []byte
+func ParsePlist(data []byte) (interface{}, error) {
+	if bytes.HasPrefix(data, []byte("bplist00")) {
+		return parseBinaryPlist(data)
+	}
+	return parseXMLPlist(data)
+}
+
+func parseXMLPlist(data []byte) (interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML plist: %s", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			if start.Name.Local == "plist" {
+				continue
+			}
+			return parseXMLValue(decoder, start)
+		}
+	}
+}
+
+func parseXMLValue(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := map[string]interface{}{}
+		key := ""
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch token := token.(type) {
+			case xml.StartElement:
+				if token.Name.Local == "key" {
+					if err := decoder.DecodeElement(&key, &token); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				value, err := parseXMLValue(decoder, token)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = value
+			case xml.EndElement:
+				return dict, nil
+			}
+		}
+	case "array":
+		array := []interface{}{}
+		for {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch token := token.(type) {
+			case xml.StartElement:
+				value, err := parseXMLValue(decoder, token)
+				if err != nil {
+					return nil, err
+				}
+				array = append(array, value)
+			case xml.EndElement:
+				return array, nil
+			}
+		}
+	case "true", "false":
+		if err := decoder.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	var text string
+	if err := decoder.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	text = strings.TrimSpace(text)
+	switch start.Name.Local {
+	case "string":
+		return text, nil
+	case "integer":
+		return strconv.ParseInt(text, 10, 64)
+	case "real":
+		return strconv.ParseFloat(text, 64)
+	case "date":
+		return time.Parse(time.RFC3339, text)
+	case "data":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	default:
+		return nil, fmt.Errorf("unknown plist element <%s>", start.Name.Local)
+	}
+}
+
+// Binary plist format: https://opensource.apple.com/source/CF/CF-1153.18/CFBinaryPList.c
+type binaryPlist struct {
+	data          []byte
+	offsets       []uint64
+	objectRefSize int
+	depth         int
+}
+
+func parseBinaryPlist(data []byte) (interface{}, error) {
+	if len(data) < 8+32 {
+		return nil, errors.New("binary plist is too short")
+	}
+	trailer := data[len(data)-32:]
+	offsetIntSize := int(trailer[6])
+	objectRefSize := int(trailer[7])
+	numObjects := binary.BigEndian.Uint64(trailer[8:16])
+	topObject := binary.BigEndian.Uint64(trailer[16:24])
+	offsetTableOffset := binary.BigEndian.Uint64(trailer[24:32])
+	if offsetIntSize == 0 || objectRefSize == 0 || numObjects > uint64(len(data)) || offsetTableOffset > uint64(len(data)) ||
+		offsetTableOffset+numObjects*uint64(offsetIntSize) > uint64(len(data)) {
+		return nil, errors.New("invalid binary plist trailer")
+	}
+
+	plist := &binaryPlist{data: data, objectRefSize: objectRefSize, offsets: make([]uint64, numObjects)}
+	for i := range plist.offsets {
+		start := offsetTableOffset + uint64(i*offsetIntSize)
+		plist.offsets[i] = readUint(data[start : start+uint64(offsetIntSize)])
+	}
+	return plist.object(topObject)
+}
+
+func readUint(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+func (plist *binaryPlist) object(ref uint64) (interface{}, error) {
+	if ref >= uint64(len(plist.offsets)) || plist.offsets[ref] >= uint64(len(plist.data)) {
+		return nil, fmt.Errorf("invalid object reference %d in binary plist", ref)
+	}
+	// Guards against reference cycles in malformed files
+	if plist.depth > 512 {
+		return nil, errors.New("binary plist is nested too deeply")
+	}
+	plist.depth++
+	defer func() { plist.depth-- }()
+
+	offset := plist.offsets[ref]
+	marker := plist.data[offset]
+	kind, info := marker>>4, int(marker&0x0f)
+	body := offset + 1
+
+	switch kind {
+	case 0x0:
+		switch marker {
+		case 0x08:
+			return false, nil
+		case 0x09:
+			return true, nil
+		}
+		return nil, nil
+	case 0x1:
+		b, err := plist.bytes(body, 1<<uint(info))
+		if err != nil {
+			return nil, err
+		}
+		return int64(readUint(b)), nil
+	case 0x2:
+		b, err := plist.bytes(body, 1<<uint(info))
+		if err != nil {
+			return nil, err
+		}
+		if len(b) == 4 {
+			return float64(math.Float32frombits(uint32(readUint(b)))), nil
+		}
+		return math.Float64frombits(readUint(b)), nil
+	case 0x3:
+		b, err := plist.bytes(body, 8)
+		if err != nil {
+			return nil, err
+		}
+		seconds := math.Float64frombits(readUint(b))
+		return time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(seconds * float64(time.Second))), nil
+	case 0x8:
+		b, err := plist.bytes(body, info+1)
+		if err != nil {
+			return nil, err
+		}
+		return int64(readUint(b)), nil
+	}
+
+	count, body, err := plist.count(info, body)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case 0x4:
+		return plist.bytes(body, count)
+	case 0x5:
+		b, err := plist.bytes(body, count)
+		return string(b), err
+	case 0x6:
+		b, err := plist.bytes(body, count*2)
+		if err != nil {
+			return nil, err
+		}
+		units := make([]uint16, count)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(b[i*2:])
+		}
+		return string(utf16.Decode(units)), nil
+	case 0xA:
+		refs, err := plist.refs(body, count)
+		if err != nil {
+			return nil, err
+		}
+		array := make([]interface{}, count)
+		for i, ref := range refs {
+			if array[i], err = plist.object(ref); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	case 0xD:
+		refs, err := plist.refs(body, count*2)
+		if err != nil {
+			return nil, err
+		}
+		dict := map[string]interface{}{}
+		for i := 0; i < count; i++ {
+			key, err := plist.object(refs[i])
+			if err != nil {
+				return nil, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, errors.New("dictionary key of binary plist is not a string")
+			}
+			if dict[keyString], err = plist.object(refs[count+i]); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	default:
+		return nil, fmt.Errorf("unknown object type 0x%x in binary plist", marker)
+	}
+}
+
+// Reads the count of data/string/array/dict. 0xf in the marker means the count follows as an int object
+func (plist *binaryPlist) count(info int, body uint64) (int, uint64, error) {
+	if info != 0x0f {
+		return info, body, nil
+	}
+	if body >= uint64(len(plist.data)) || plist.data[body]>>4 != 0x1 {
+		return 0, 0, errors.New("invalid count in binary plist")
+	}
+	size := 1 << uint(plist.data[body]&0x0f)
+	b, err := plist.bytes(body+1, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	count := readUint(b)
+	if count > uint64(len(plist.data)) {
+		return 0, 0, errors.New("invalid count in binary plist")
+	}
+	return int(count), body + 1 + uint64(size), nil
+}
+
+func (plist *binaryPlist) refs(body uint64, count int) ([]uint64, error) {
+	b, err := plist.bytes(body, count*plist.objectRefSize)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]uint64, count)
+	for i := range refs {
+		refs[i] = readUint(b[i*plist.objectRefSize : (i+1)*plist.objectRefSize])
+	}
+	return refs, nil
+}
+
+func (plist *binaryPlist) bytes(start uint64, length int) ([]byte, error) {
+	end := start + uint64(length)
+	if end > uint64(len(plist.data)) || end < start {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return plist.data[start:end], nil
+}
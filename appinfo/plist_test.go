@@ -0,0 +1,108 @@
+package appinfo
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testdata/Info.plist and Info.bplist are the same property list written by Python plistlib in XML and binary format
+var infoPlist = map[string]interface{}{
+	"BuildDate":                    time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	"CFBundleDisplayName":          "Äpp",
+	"CFBundleExecutable":           "Example",
+	"CFBundleIdentifier":           "com.example.app",
+	"Data":                         []byte{0, 1, 2},
+	"LSRequiresIPhoneOS":           true,
+	"LargeNumber":                  int64(1 << 40),
+	"MinimumBuildNumber":           int64(42),
+	"Nested":                       map[string]interface{}{"Key": "Value"},
+	"Scale":                        1.5,
+	"UIFileSharingEnabled":         false,
+	"UIRequiredDeviceCapabilities": []interface{}{"arm64"},
+}
+
+func readTestData(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParsePlist(t *testing.T) {
+	for _, name := range []string{"Info.plist", "Info.bplist"} {
+		t.Run(name, func(t *testing.T) {
+			plist, err := ParsePlist(readTestData(t, name))
+			if err != nil {
+				t.Fatalf("ParsePlist() error = %v", err)
+			}
+			if !reflect.DeepEqual(plist, infoPlist) {
+				t.Errorf("ParsePlist() = %#v, want %#v", plist, infoPlist)
+			}
+		})
+	}
+}
+
+func TestParsePlistErrors(t *testing.T) {
+	bplist := readTestData(t, "Info.bplist")
+	// Returns a copy of the binary plist whose trailer field at the offset from the end of the trailer is replaced
+	withTrailer := func(offset int, value uint64) []byte {
+		data := append([]byte{}, bplist...)
+		binary.BigEndian.PutUint64(data[len(data)-32+offset:], value)
+		return data
+	}
+	// Binary plist whose only object is an array containing itself
+	cyclic := append([]byte("bplist00"), 0xa1, 0x00, 0x08)
+	cyclic = append(cyclic, make([]byte, 32)...)
+	trailer := cyclic[len(cyclic)-32:]
+	trailer[6], trailer[7] = 1, 1
+	binary.BigEndian.PutUint64(trailer[8:], 1)
+	binary.BigEndian.PutUint64(trailer[24:], 10)
+
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"empty", []byte{}, "invalid XML plist"},
+		{"binary header only", []byte("bplist00"), "too short"},
+		{"unclosed XML dict", []byte("<plist><dict><key>A</key><string>B</string>"), "EOF"},
+		{"unknown XML element", []byte("<plist><dict><key>A</key><foo>B</foo></dict></plist>"), "unknown plist element <foo>"},
+		{"invalid XML integer", []byte("<plist><integer>x</integer></plist>"), "invalid syntax"},
+		{"invalid XML data", []byte("<plist><data>!</data></plist>"), "illegal base64"},
+		{"truncated binary", bplist[:len(bplist)-1], "invalid"},
+		{"too many objects", withTrailer(8, 1<<40), "invalid binary plist trailer"},
+		{"offset table out of range", withTrailer(24, uint64(len(bplist))), "invalid binary plist trailer"},
+		{"overflowing offset table", withTrailer(24, ^uint64(0)), "invalid binary plist trailer"},
+		{"top object out of range", withTrailer(16, 1000), "invalid object reference"},
+		{"reference cycle", cyclic, "nested too deeply"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParsePlist(test.data)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ParsePlist() error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+// Broken files must be reported as errors, not panics
+func TestParsePlistDoesNotPanic(t *testing.T) {
+	for _, name := range []string{"Info.plist", "Info.bplist"} {
+		data := readTestData(t, name)
+		for i := range data {
+			ParsePlist(data[:i])
+			for _, b := range []byte{0x00, 0xff} {
+				corrupt := append([]byte{}, data...)
+				corrupt[i] = b
+				ParsePlist(corrupt)
+			}
+		}
+	}
+}
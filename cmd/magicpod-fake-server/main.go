@@ -0,0 +1,53 @@
+// magicpod-fake-server runs fakeserver as a standalone process, so the step can be executed end-to-end without network.
+//
+//	go run ./cmd/magicpod-fake-server -addr 127.0.0.1:8080 -statuses running,succeeded
+//
+// Then set `base_url` of the step to http://127.0.0.1:8080/api/v1.0
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod/fakeserver"
+)
+
+func failf(format string, v ...interface{}) {
+	log.Errorf(format, v...)
+	os.Exit(1)
+}
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "Address to listen on")
+	scenarioPath := flag.String("scenario", "", "JSON file of fakeserver.Scenario")
+	statuses := flag.String("statuses", "", "Comma separated statuses returned by batch-run/{n}/ in order (overrides the scenario file)")
+	token := flag.String("token", "", "API token to accept. Any token is accepted if empty")
+	latency := flag.Duration("latency", 0, "Latency added to every response")
+	flag.Parse()
+
+	var scenario fakeserver.Scenario
+	if *scenarioPath != "" {
+		data, err := ioutil.ReadFile(*scenarioPath)
+		if err != nil {
+			failf("Failed to read scenario file, error: %s", err)
+		}
+		if err := json.Unmarshal(data, &scenario); err != nil {
+			failf("Failed to parse scenario file, error: %s", err)
+		}
+	}
+	if *statuses != "" {
+		scenario.Statuses = strings.Split(*statuses, ",")
+	}
+	scenario.Token = *token
+	scenario.Latency = *latency
+
+	log.Infof("Fake Magic Pod server is listening on %s", *addr)
+	if err := http.ListenAndServe(*addr, fakeserver.New(scenario)); err != nil {
+		failf(err.Error())
+	}
+}
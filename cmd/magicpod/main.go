@@ -0,0 +1,219 @@
+// magicpod runs the same operations as the Bitrise step from a terminal or other CI services.
+//
+//	magicpod run -organization-name MagicPodOrg1 -project-name MagicPodPrj1 -os Android -device-type Emulator -app-path app.apk
+//
+// Every input of step.yml is available as a flag with `-` instead of `_` (e.g. `-test-case-numbers`),
+// or as an environment variable prefixed with `MAGIC_POD_` (e.g. `MAGIC_POD_TEST_CASE_NUMBERS`, `MAGIC_POD_API_TOKEN`).
+// Flags take precedence over environment variables, and the defaults are the same as step.yml
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-tools/go-steputils/stepconf"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/step"
+)
+
+// Same as the defaults in step.yml, except the ones which refer to the environment variables of Bitrise.
+// TestInputDefaultsMatchStepYML keeps them in sync
+var inputDefaults = map[string]string{
+	"base_url":             "https://magic-pod.com/api/v1.0",
+	"environment":          "Magic Pod",
+	"os":                   "iOS",
+	"device_type":          "Simulator",
+	"version":              "13.1",
+	"model":                "iPhone 8",
+	"app_type":             "App file (cloud upload)",
+	"upload_retry_count":   "3",
+	"upload_timeout":       "1800",
+	"matrix_fail_policy":   "any",
+	"mode":                 "start_and_wait",
+	"wait_for_result":      "true",
+	"poll_interval":        "15",
+	"poll_backoff":         "false",
+	"max_poll_interval":    "60",
+	"max_wait_time":        "0",
+	"cancel_on_abort":      "true",
+	"reattach_batch_run":   "false",
+	"unresolved_policy":    "fail",
+	"download_artifacts":   "none",
+	"download_concurrency": "4",
+	"download_max_size_mb": "500",
+	"output_sinks":         "auto",
+	"send_mail":            "true",
+	"shard_strategy":       "round_robin",
+	"auto_rerun_failed":    "false",
+	"retry_count":          "0",
+	"capture_type":         "Every step",
+	"device_language":      "Default",
+	"device_region":        "Default",
+	"dry_run":              "false",
+}
+
+type command struct {
+	usage       string
+	description string
+	run         func(cfg step.Config, batchRunNumbers []int)
+}
+
+var commands = map[string]command{
+	"upload": {"<app path>", "Validate and upload the app file, and print its file number", func(cfg step.Config, _ []int) {
+		fmt.Println(step.Upload(cfg))
+	}},
+	"run": {"", "Start batch runs and wait for the results in the same way as the Bitrise step", func(cfg step.Config, _ []int) {
+		step.Run(cfg)
+	}},
+	"status": {"<batch run number>...", "Print the current status of the batch runs", step.Status},
+	"wait": {"<batch run number>...", "Wait for the batch runs and report the results", func(cfg step.Config, _ []int) {
+		step.Run(cfg)
+	}},
+	"cancel": {"<batch run number>...", "Cancel the running batch runs", step.Cancel},
+	"report": {"<batch run number>...", "Report the finished batch runs and decide whether they pass", step.Report},
+}
+
+var commandNames = []string{"upload", "run", "status", "wait", "cancel", "report"}
+
+func failf(format string, v ...interface{}) {
+	log.Errorf(format, v...)
+	os.Exit(1)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: magicpod <command> [flags] [arguments]\n\nCommands:\n")
+	for _, name := range commandNames {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun `magicpod <command> -h` for the flags.\n")
+}
+
+// Names of the inputs in the `env` tags of step.Config
+func inputNames() []string {
+	names := []string{}
+	configType := reflect.TypeOf(step.Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		if tag := configType.Field(i).Tag.Get("env"); tag != "" {
+			names = append(names, strings.Split(tag, ",")[0])
+		}
+	}
+	return names
+}
+
+func environmentVariableName(input string) string {
+	name := strings.ToUpper(input)
+	if strings.HasPrefix(name, "MAGIC_POD_") {
+		return name
+	}
+	return "MAGIC_POD_" + name
+}
+
+func parseBatchRunNumbers(args []string) ([]int, error) {
+	numbers := []int{}
+	for _, arg := range args {
+		for _, str := range strings.Split(arg, ",") {
+			if str = strings.TrimSpace(str); str == "" {
+				continue
+			}
+			number, err := strconv.Atoi(str)
+			if err != nil || number <= 0 {
+				return nil, fmt.Errorf("batch run number %s should be a positive integer", str)
+			}
+			numbers = append(numbers, number)
+		}
+	}
+	if len(numbers) == 0 {
+		return nil, fmt.Errorf("no batch run number is specified")
+	}
+	return numbers, nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("magicpod "+name, flag.ExitOnError)
+	values := map[string]*string{}
+	for _, input := range inputNames() {
+		values[input] = flags.String(strings.Replace(input, "_", "-", -1), "",
+			fmt.Sprintf("$%s (default %q)", environmentVariableName(input), inputDefaults[input]))
+	}
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: magicpod %s [flags] %s\n\n%s\n\nFlags:\n", name, cmd.usage, cmd.description)
+		flags.PrintDefaults()
+	}
+	// Flags may follow the arguments, e.g. `magicpod report 123 -allowed-failures 1`
+	args := []string{}
+	for rest := os.Args[2:]; ; {
+		if err := flags.Parse(rest); err != nil {
+			failf(err.Error())
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		args = append(args, flags.Arg(0))
+		rest = flags.Args()[1:]
+	}
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[strings.Replace(f.Name, "-", "_", -1)] = true })
+
+	// step.Config is parsed from the environment variables named after the inputs, in the same way as the Bitrise step
+	for _, input := range inputNames() {
+		value, ok := *values[input], set[input]
+		if !ok {
+			value, ok = os.LookupEnv(environmentVariableName(input))
+		}
+		if !ok {
+			value = inputDefaults[input]
+		}
+		if err := os.Setenv(input, value); err != nil {
+			failf(err.Error())
+		}
+	}
+
+	var batchRunNumbers []int
+	switch name {
+	case "upload":
+		if len(args) > 1 {
+			failf("Only one app file can be uploaded")
+		}
+		if len(args) == 1 {
+			os.Setenv("app_path", args[0])
+		}
+	case "run":
+		if len(args) != 0 {
+			failf("Unexpected arguments: %s", strings.Join(args, " "))
+		}
+	default:
+		var err error
+		if batchRunNumbers, err = parseBatchRunNumbers(args); err != nil {
+			failf(err.Error())
+		}
+		if name == "wait" {
+			strs := make([]string, len(batchRunNumbers))
+			for i, number := range batchRunNumbers {
+				strs[i] = strconv.Itoa(number)
+			}
+			os.Setenv("mode", "wait")
+			os.Setenv("batch_run_numbers", strings.Join(strs, ","))
+		}
+	}
+
+	var cfg step.Config
+	if err := stepconf.Parse(&cfg); err != nil {
+		failf(err.Error())
+	}
+	cmd.run(cfg, batchRunNumbers)
+}
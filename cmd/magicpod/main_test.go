@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestInputDefaultsMatchStepYML(t *testing.T) {
+	data, err := ioutil.ReadFile("../../step.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stepYML struct {
+		Inputs []map[string]interface{} `yaml:"inputs"`
+	}
+	if err := yaml.Unmarshal(data, &stepYML); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{}
+	for _, input := range stepYML.Inputs {
+		for name, value := range input {
+			if name == "opts" || value == nil {
+				continue
+			}
+			// Environment variables of Bitrise are not available outside of it
+			if value := fmt.Sprint(value); value != "" && !strings.HasPrefix(value, "$") {
+				want[name] = value
+			}
+		}
+	}
+	if !reflect.DeepEqual(inputDefaults, want) {
+		for name, value := range want {
+			if inputDefaults[name] != value {
+				t.Errorf("inputDefaults[%q] = %q, want %q as step.yml", name, inputDefaults[name], value)
+			}
+		}
+		for name := range inputDefaults {
+			if _, ok := want[name]; !ok {
+				t.Errorf("inputDefaults has %q which has no default in step.yml", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Package magicpod is a client of Magic Pod Web API (https://magic-pod.com/api/v1.0/doc/).
+// Every operation returns an error instead of exiting, so it can be shared by the Bitrise step and other tools.
+package magicpod
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"gopkg.in/resty.v1"
+)
+
+// Client : Magic Pod Web API client bound to one project
+type Client struct {
+	apiToken         string
+	organizationName string
+	projectName      string
+	rest             *resty.Client
+}
+
+// NewClient : Create a client for the project `organizationName/projectName`.
+// httpClient can be nil, then a default one is used.
+func NewClient(baseURL, apiToken, organizationName, projectName string, httpClient *http.Client) *Client {
+	var rest *resty.Client
+	if httpClient == nil {
+		rest = resty.New()
+	} else {
+		rest = resty.NewWithClient(httpClient)
+	}
+	rest.SetHostURL(baseURL)
+	return &Client{
+		apiToken:         apiToken,
+		organizationName: organizationName,
+		projectName:      projectName,
+		rest:             rest,
+	}
+}
+
+// OrganizationName : Organization name the client is bound to
+func (c *Client) OrganizationName() string {
+	return c.organizationName
+}
+
+// ProjectName : Project name the client is bound to
+func (c *Client) ProjectName() string {
+	return c.projectName
+}
+
+func (c *Client) newRequest() *resty.Request {
+	return c.rest.R().
+		SetHeader("Authorization", "Token "+c.apiToken).
+		SetPathParams(map[string]string{
+			"organization_name": c.organizationName,
+			"project_name":      c.projectName,
+		})
+}
+
+// UploadFile : Upload an app file to Magic Pod cloud. The returned FileNo is used as `app_file_number` of StartBatchRun
+func (c *Client) UploadFile(filePath string) (*UploadFile, error) {
+	return c.UploadFileWithOptions(filePath, UploadOptions{})
+}
+
+// GetUploadFile : Get the uploaded app file. It returns *APIError with status 404 when the file has been deleted or expired
+func (c *Client) GetUploadFile(fileNo int) (*UploadFile, error) {
+	resp, err := c.newRequest().
+		SetPathParams(map[string]string{
+			"file_no": strconv.Itoa(fileNo),
+		}).
+		SetResult(UploadFile{}).
+		Get("/{organization_name}/{project_name}/upload-file/{file_no}/")
+	if err := checkResponse("upload-file/"+strconv.Itoa(fileNo), resp, err); err != nil {
+		return nil, err
+	}
+	return resp.Result().(*UploadFile), nil
+}
+
+// StartBatchRun : Start a batch run with the parameters of batch-run API
+func (c *Client) StartBatchRun(params map[string]interface{}) (*BatchRun, error) {
+	resp, err := c.newRequest().
+		SetResult(BatchRun{}).
+		SetBody(params).
+		Post("/{organization_name}/{project_name}/batch-run/")
+	if err := checkResponse("batch-run", resp, err); err != nil {
+		return nil, err
+	}
+	return resp.Result().(*BatchRun), nil
+}
+
+// GetBatchRun : Get the current status of the batch run
+func (c *Client) GetBatchRun(batchRunNumber int) (*BatchRun, error) {
+	batchRun, _, err := c.getBatchRun(batchRunNumber)
+	return batchRun, err
+}
+
+// Also returns `Retry-After` of the response to decide next polling time
+func (c *Client) getBatchRun(batchRunNumber int) (*BatchRun, time.Duration, error) {
+	resp, err := c.newRequest().
+		SetPathParams(map[string]string{
+			"batch_run_number": strconv.Itoa(batchRunNumber),
+		}).
+		SetResult(BatchRun{}).
+		Get("/{organization_name}/{project_name}/batch-run/{batch_run_number}/")
+	if err := checkResponse("batch-run/"+strconv.Itoa(batchRunNumber), resp, err); err != nil {
+		return nil, 0, err
+	}
+	return resp.Result().(*BatchRun), parseRetryAfter(resp.Header()), nil
+}
+
+// ListBatchRuns : List the latest batch runs of the project, in descending order of the batch run number.
+// TestCases of them do not have Details, so use GetBatchRun to get the result of each test case
+func (c *Client) ListBatchRuns(count int) ([]BatchRun, error) {
+	resp, err := c.newRequest().
+		SetQueryParam("count", strconv.Itoa(count)).
+		SetResult(BatchRuns{}).
+		Get("/{organization_name}/{project_name}/batch-runs/")
+	if err := checkResponse("batch-runs", resp, err); err != nil {
+		return nil, err
+	}
+	return resp.Result().(*BatchRuns).BatchRuns, nil
+}
+
+// ListTestCases : List all test cases of the project
+func (c *Client) ListTestCases() ([]TestCase, error) {
+	resp, err := c.newRequest().
+		SetResult(TestCaseList{}).
+		Get("/{organization_name}/{project_name}/test-cases/")
+	if err := checkResponse("test-cases", resp, err); err != nil {
+		return nil, err
+	}
+	return resp.Result().(*TestCaseList).TestCases, nil
+}
+
+// CancelBatchRun : Stop the running batch run. Its status becomes `aborted`
+func (c *Client) CancelBatchRun(batchRunNumber int) error {
+	resp, err := c.newRequest().
+		SetPathParams(map[string]string{
+			"batch_run_number": strconv.Itoa(batchRunNumber),
+		}).
+		Post("/{organization_name}/{project_name}/batch-run/{batch_run_number}/stop/")
+	return checkResponse("batch-run/"+strconv.Itoa(batchRunNumber)+"/stop", resp, err)
+}
+
+// ListArtifacts : List screenshots, videos and device logs recorded in the finished batch run
+func (c *Client) ListArtifacts(batchRunNumber int) ([]Artifact, error) {
+	resp, err := c.newRequest().
+		SetPathParams(map[string]string{
+			"batch_run_number": strconv.Itoa(batchRunNumber),
+		}).
+		SetResult([]Artifact{}).
+		Get("/{organization_name}/{project_name}/batch-run/{batch_run_number}/artifacts/")
+	if err := checkResponse("batch-run/"+strconv.Itoa(batchRunNumber)+"/artifacts", resp, err); err != nil {
+		return nil, err
+	}
+	return *resp.Result().(*[]Artifact), nil
+}
+
+// DownloadArtifact : Write content of the artifact into w and return the written size.
+// API token is sent only when the artifact is hosted on Magic Pod itself (not on external storage)
+func (c *Client) DownloadArtifact(artifact Artifact, w io.Writer) (int64, error) {
+	request := c.rest.R().SetDoNotParseResponse(true)
+	if c.isSameHost(artifact.URL) {
+		request.SetHeader("Authorization", "Token "+c.apiToken)
+	}
+	op := "download " + artifact.FileName
+	resp, err := request.Get(artifact.URL)
+	if err != nil {
+		return 0, &RequestError{Op: op, Err: err}
+	}
+	body := resp.RawBody()
+	defer body.Close()
+	if resp.StatusCode() != 200 {
+		message, _ := ioutil.ReadAll(io.LimitReader(body, 1024))
+		return 0, &APIError{Op: op, StatusCode: resp.StatusCode(), Status: resp.Status(), Body: string(message)}
+	}
+	written, err := io.Copy(w, body)
+	if err != nil {
+		return written, &RequestError{Op: op, Err: err}
+	}
+	return written, nil
+}
+
+func (c *Client) isSameHost(rawURL string) bool {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	if !target.IsAbs() {
+		return true
+	}
+	host, err := url.Parse(c.rest.HostURL)
+	return err == nil && target.Scheme == host.Scheme && target.Host == host.Host
+}
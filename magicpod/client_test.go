@@ -0,0 +1,309 @@
+package magicpod_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod/fakeserver"
+)
+
+func newTestClient(t *testing.T, scenario fakeserver.Scenario) (*magicpod.Client, *fakeserver.Server) {
+	scenario.Token = "token"
+	fake := fakeserver.New(scenario)
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return magicpod.NewClient(server.URL+"/api/v1.0", "token", "Org", "Prj", nil), fake
+}
+
+func writeAppFile(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "app.apk")
+	if err := ioutil.WriteFile(path, []byte("apk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var startParams = map[string]interface{}{
+	"environment":     "magic_pod",
+	"os":              "android",
+	"device_type":     "emulator",
+	"app_type":        "app_file",
+	"app_file_number": 1,
+}
+
+// Parameters which do not need an uploaded app file
+var appURLParams = map[string]interface{}{
+	"environment": "magic_pod",
+	"os":          "ios",
+	"device_type": "simulator",
+	"app_type":    "app_url",
+}
+
+func TestUploadFile(t *testing.T) {
+	client, fake := newTestClient(t, fakeserver.Scenario{})
+	sent := int64(0)
+	uploadFile, err := client.UploadFileWithOptions(writeAppFile(t), magicpod.UploadOptions{
+		OnProgress: func(s, total int64) { sent = s },
+	})
+	if err != nil {
+		t.Fatalf("UploadFileWithOptions() error = %v", err)
+	}
+	if uploadFile.FileNo != 1 || uploadFile.FileName != "app.apk" {
+		t.Errorf("UploadFileWithOptions() = %+v", uploadFile)
+	}
+	if sent == 0 {
+		t.Error("OnProgress was not called")
+	}
+	if names := fake.UploadedFileNames(); !reflect.DeepEqual(names, []string{"app.apk"}) {
+		t.Errorf("UploadedFileNames() = %v", names)
+	}
+	if _, err := client.GetUploadFile(1); err != nil {
+		t.Errorf("GetUploadFile(1) error = %v", err)
+	}
+	_, err = client.GetUploadFile(2)
+	if apiErr, ok := err.(*magicpod.APIError); !ok || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("GetUploadFile(2) error = %v, want 404", err)
+	}
+}
+
+func TestUploadFileRetriesTransientErrors(t *testing.T) {
+	client, fake := newTestClient(t, fakeserver.Scenario{Faults: map[string][]*fakeserver.Fault{
+		fakeserver.EndpointUploadFile: {{StatusCode: http.StatusServiceUnavailable}, {CloseConnection: true}},
+	}})
+	retries := 0
+	uploadFile, err := client.UploadFileWithOptions(writeAppFile(t), magicpod.UploadOptions{
+		Retries:   2,
+		RetryWait: time.Millisecond,
+		OnRetry:   func(int, time.Duration, error) { retries++ },
+	})
+	if err != nil {
+		t.Fatalf("UploadFileWithOptions() error = %v", err)
+	}
+	if uploadFile.FileNo != 1 || retries != 2 {
+		t.Errorf("UploadFileWithOptions() = %+v after %d retries, want file 1 after 2 retries", uploadFile, retries)
+	}
+	if len(fake.RequestLog()) != 3 {
+		t.Errorf("RequestLog() = %v, want 3 requests", fake.RequestLog())
+	}
+}
+
+func TestUploadFileDoesNotRetryClientErrors(t *testing.T) {
+	client, _ := newTestClient(t, fakeserver.Scenario{Faults: map[string][]*fakeserver.Fault{
+		fakeserver.EndpointUploadFile: {{StatusCode: http.StatusBadRequest, FieldErrors: map[string][]string{"file": {"Invalid file."}}}},
+	}})
+	_, err := client.UploadFileWithOptions(writeAppFile(t), magicpod.UploadOptions{Retries: 2, RetryWait: time.Millisecond})
+	apiErr, ok := err.(*magicpod.APIError)
+	if !ok || apiErr.StatusCode != http.StatusBadRequest || !reflect.DeepEqual(apiErr.FieldErrors["file"], []string{"Invalid file."}) {
+		t.Errorf("UploadFileWithOptions() error = %#v, want field errors of 400", err)
+	}
+}
+
+func TestUploadFileDoesNotRetryDecodeErrors(t *testing.T) {
+	client, fake := newTestClient(t, fakeserver.Scenario{Faults: map[string][]*fakeserver.Fault{
+		fakeserver.EndpointUploadFile: {{StatusCode: http.StatusOK, Body: "<html>Maintenance</html>"}},
+	}})
+	_, err := client.UploadFileWithOptions(writeAppFile(t), magicpod.UploadOptions{Retries: 2, RetryWait: time.Millisecond})
+	if _, ok := err.(*magicpod.DecodeError); !ok {
+		t.Errorf("UploadFileWithOptions() error = %#v, want DecodeError", err)
+	}
+	if len(fake.RequestLog()) != 1 {
+		t.Errorf("RequestLog() = %v, want 1 request", fake.RequestLog())
+	}
+}
+
+func TestStartAndWaitBatchRun(t *testing.T) {
+	results := []magicpod.TestCaseResult{{Number: 1, Status: "succeeded"}, {Number: 2, Status: "failed"}}
+	client, fake := newTestClient(t, fakeserver.Scenario{Statuses: []string{"running", "running", "failed"}, Results: results})
+	if _, err := client.UploadFile(writeAppFile(t)); err != nil {
+		t.Fatal(err)
+	}
+	batchRun, err := client.StartBatchRun(startParams)
+	if err != nil {
+		t.Fatalf("StartBatchRun() error = %v", err)
+	}
+	if batchRun.BatchRunNumber != 1 || batchRun.Status != "running" {
+		t.Errorf("StartBatchRun() = %+v", batchRun)
+	}
+	if params := fake.BatchRunParams(1); params["os"] != "android" || params["app_file_number"] != float64(1) {
+		t.Errorf("BatchRunParams(1) = %v", params)
+	}
+
+	polls := 0
+	finished, err := client.WaitBatchRun(context.Background(), batchRun.BatchRunNumber, magicpod.WaitOptions{
+		Interval: time.Millisecond,
+		OnPoll:   func(*magicpod.BatchRun) { polls++ },
+	})
+	if err != nil {
+		t.Fatalf("WaitBatchRun() error = %v", err)
+	}
+	if finished.Status != "failed" || polls != 3 {
+		t.Errorf("WaitBatchRun() = %s after %d polls, want failed after 3 polls", finished.Status, polls)
+	}
+	if finished.TestCases.Failed != 1 || !reflect.DeepEqual(finished.TestCaseNumbers("failed"), []int{2}) {
+		t.Errorf("WaitBatchRun() test cases = %+v", finished.TestCases)
+	}
+}
+
+func TestStartBatchRunValidationError(t *testing.T) {
+	client, _ := newTestClient(t, fakeserver.Scenario{})
+	_, err := client.StartBatchRun(map[string]interface{}{"os": "android"})
+	apiErr, ok := err.(*magicpod.APIError)
+	if !ok || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("StartBatchRun() error = %v, want 400", err)
+	}
+	for _, key := range []string{"environment", "device_type", "app_type"} {
+		if len(apiErr.FieldErrors[key]) == 0 {
+			t.Errorf("FieldErrors[%s] is empty: %v", key, apiErr.FieldErrors)
+		}
+	}
+}
+
+func TestInvalidToken(t *testing.T) {
+	fake := fakeserver.New(fakeserver.Scenario{Token: "token"})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := magicpod.NewClient(server.URL+"/api/v1.0", "wrong", "Org", "Prj", nil)
+	_, err := client.GetBatchRun(1)
+	if apiErr, ok := err.(*magicpod.APIError); !ok || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Detail != "Invalid token." {
+		t.Errorf("GetBatchRun() error = %v, want 401", err)
+	}
+}
+
+func TestWaitBatchRunRetriesThrottledResponses(t *testing.T) {
+	client, fake := newTestClient(t, fakeserver.Scenario{Statuses: []string{"running", "succeeded"}, Faults: map[string][]*fakeserver.Fault{
+		fakeserver.EndpointGetBatchRun: {
+			{StatusCode: http.StatusTooManyRequests, RetryAfter: 1},
+			{StatusCode: http.StatusServiceUnavailable, Body: "<html>maintenance</html>"},
+		},
+	}})
+	if _, err := client.StartBatchRun(appURLParams); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	finished, err := client.WaitBatchRun(context.Background(), 1, magicpod.WaitOptions{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("WaitBatchRun() error = %v", err)
+	}
+	if finished.Status != "succeeded" {
+		t.Errorf("WaitBatchRun() status = %s", finished.Status)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("WaitBatchRun() returned in %s, want to honour Retry-After of 1 second", elapsed)
+	}
+	if len(fake.RequestLog()) != 5 {
+		t.Errorf("RequestLog() = %v, want start + 4 polls", fake.RequestLog())
+	}
+}
+
+func TestWaitBatchRunHonoursRetryAfterOfSuccessfulResponses(t *testing.T) {
+	client, _ := newTestClient(t, fakeserver.Scenario{Statuses: []string{"running", "succeeded"}, RetryAfter: 1})
+	if _, err := client.StartBatchRun(appURLParams); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := client.WaitBatchRun(context.Background(), 1, magicpod.WaitOptions{Interval: time.Millisecond}); err != nil {
+		t.Fatalf("WaitBatchRun() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("WaitBatchRun() returned in %s, want to honour Retry-After of 1 second", elapsed)
+	}
+}
+
+func TestWaitBatchRunRetriesRequestErrors(t *testing.T) {
+	client, fake := newTestClient(t, fakeserver.Scenario{Statuses: []string{"running", "succeeded"}, Faults: map[string][]*fakeserver.Fault{
+		fakeserver.EndpointGetBatchRun: {
+			{CloseConnection: true},
+			{StatusCode: http.StatusBadGateway},
+		},
+	}})
+	if _, err := client.StartBatchRun(appURLParams); err != nil {
+		t.Fatal(err)
+	}
+	finished, err := client.WaitBatchRun(context.Background(), 1, magicpod.WaitOptions{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("WaitBatchRun() error = %v", err)
+	}
+	if finished.Status != "succeeded" {
+		t.Errorf("WaitBatchRun() status = %s", finished.Status)
+	}
+	if len(fake.RequestLog()) != 5 {
+		t.Errorf("RequestLog() = %v, want start + 4 polls", fake.RequestLog())
+	}
+}
+
+func TestWaitBatchRunGivesUpTransientErrors(t *testing.T) {
+	faults := []*fakeserver.Fault{}
+	for i := 0; i < 100; i++ {
+		faults = append(faults, &fakeserver.Fault{StatusCode: http.StatusInternalServerError, Detail: "Server error."})
+	}
+	client, fake := newTestClient(t, fakeserver.Scenario{Faults: map[string][]*fakeserver.Fault{fakeserver.EndpointGetBatchRun: faults}})
+	if _, err := client.StartBatchRun(appURLParams); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without timeout, only a limited number of failures in a row are retried
+	_, err := client.WaitBatchRun(context.Background(), 1, magicpod.WaitOptions{Interval: time.Millisecond})
+	if apiErr, ok := err.(*magicpod.APIError); !ok || apiErr.StatusCode != http.StatusInternalServerError || apiErr.Detail != "Server error." {
+		t.Errorf("WaitBatchRun() error = %v, want 500", err)
+	}
+	if len(fake.RequestLog()) != 7 {
+		t.Errorf("RequestLog() = %v, want start + 6 polls", fake.RequestLog())
+	}
+
+	// With timeout, they are retried until the timeout
+	_, err = client.WaitBatchRun(context.Background(), 1, magicpod.WaitOptions{Interval: 5 * time.Millisecond, Timeout: 100 * time.Millisecond})
+	if _, ok := err.(*magicpod.TimeoutError); !ok {
+		t.Errorf("WaitBatchRun() error = %v, want *TimeoutError", err)
+	}
+}
+
+func TestWaitBatchRunReturnsOtherErrors(t *testing.T) {
+	client, _ := newTestClient(t, fakeserver.Scenario{Faults: map[string][]*fakeserver.Fault{
+		fakeserver.EndpointGetBatchRun: {{StatusCode: http.StatusNotFound, Detail: "Not found."}},
+	}})
+	if _, err := client.StartBatchRun(appURLParams); err != nil {
+		t.Fatal(err)
+	}
+	_, err := client.WaitBatchRun(context.Background(), 1, magicpod.WaitOptions{Interval: time.Millisecond, Timeout: time.Minute})
+	if apiErr, ok := err.(*magicpod.APIError); !ok || apiErr.StatusCode != http.StatusNotFound || apiErr.Detail != "Not found." {
+		t.Errorf("WaitBatchRun() error = %v, want 404", err)
+	}
+}
+
+func TestWaitBatchRunTimeout(t *testing.T) {
+	client, _ := newTestClient(t, fakeserver.Scenario{Statuses: []string{"running"}})
+	if _, err := client.StartBatchRun(appURLParams); err != nil {
+		t.Fatal(err)
+	}
+	batchRun, err := client.WaitBatchRun(context.Background(), 1, magicpod.WaitOptions{Interval: 10 * time.Millisecond, Timeout: 50 * time.Millisecond})
+	if _, ok := err.(*magicpod.TimeoutError); !ok {
+		t.Fatalf("WaitBatchRun() error = %v, want *TimeoutError", err)
+	}
+	if batchRun.Status != "running" {
+		t.Errorf("WaitBatchRun() status = %s, want running", batchRun.Status)
+	}
+}
+
+func TestCancelBatchRun(t *testing.T) {
+	client, fake := newTestClient(t, fakeserver.Scenario{Statuses: []string{"running"}})
+	if _, err := client.StartBatchRun(appURLParams); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CancelBatchRun(1); err != nil {
+		t.Fatalf("CancelBatchRun() error = %v", err)
+	}
+	if !fake.BatchRunStopped(1) {
+		t.Error("BatchRunStopped(1) = false")
+	}
+	batchRun, err := client.GetBatchRun(1)
+	if err != nil || batchRun.Status != "aborted" {
+		t.Errorf("GetBatchRun() = %v, %v, want aborted", batchRun, err)
+	}
+}
@@ -0,0 +1,101 @@
+package magicpod
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/resty.v1"
+)
+
+// RequestError : Error returned when an API could not be called at all (e.g. network failure)
+type RequestError struct {
+	Op  string
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Op, e.Err)
+}
+
+// DecodeError : Error returned when an API is finished with status 200 but its response could not be decoded.
+// Retrying it would only get the same response
+type DecodeError struct {
+	Op  string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s: unexpected response: %s", e.Op, e.Err)
+}
+
+// APIError : Error returned when an API is not finished with status 200.
+// Detail is set when the server returned `{"detail": "..."}`, and FieldErrors is set when it returned
+// validation errors for each parameter like `{"app_path": ["..."]}`
+type APIError struct {
+	Op          string
+	StatusCode  int
+	Status      string
+	Detail      string
+	FieldErrors map[string][]string
+	Body        string
+	// RetryAfter is set when the server sent `Retry-After` header
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("%s: %s", e.Status, e.Detail)
+	}
+	if len(e.FieldErrors) == 0 {
+		return e.Status
+	}
+	keys := make([]string, 0, len(e.FieldErrors))
+	for key := range e.FieldErrors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	message := e.Status + ":"
+	for _, key := range keys {
+		message += fmt.Sprintf("\n\t%s: %s", key, strings.Join(e.FieldErrors[key], ","))
+	}
+	return message
+}
+
+func checkResponse(op string, resp *resty.Response, err error) error {
+	if err != nil {
+		// resty fails to parse the response into the result after it is received
+		if resp != nil && resp.StatusCode() == 200 {
+			return &DecodeError{Op: op, Err: err}
+		}
+		return &RequestError{Op: op, Err: err}
+	}
+	return checkStatus(op, resp.StatusCode(), resp.Status(), resp.Header(), resp.Body())
+}
+
+func checkStatus(op string, statusCode int, status string, header http.Header, body []byte) error {
+	if statusCode == 200 {
+		return nil
+	}
+	apiErr := &APIError{
+		Op:         op,
+		StatusCode: statusCode,
+		Status:     status,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(header),
+	}
+	var errorResp ErrorResponse
+	if err := json.Unmarshal(body, &errorResp); err == nil && errorResp.Detail != "" {
+		apiErr.Detail = errorResp.Detail
+		return apiErr
+	}
+	var fieldErrors map[string][]string
+	if err := json.Unmarshal(body, &fieldErrors); err == nil {
+		// Otherwise it unexpectedly returned HTML or something else
+		apiErr.FieldErrors = fieldErrors
+	}
+	return apiErr
+}
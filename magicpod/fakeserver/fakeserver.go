@@ -0,0 +1,471 @@
+// Package fakeserver is a fake of Magic Pod Web API for offline integration testing.
+// It can be used with httptest (`httptest.NewServer(fakeserver.New(scenario))`) or from cmd/magicpod-fake-server.
+package fakeserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+// Endpoint names used as keys of Scenario.Faults
+const (
+	EndpointUploadFile  = "upload-file"
+	EndpointGetFile     = "upload-file/{n}"
+	EndpointStartBatch  = "batch-run"
+	EndpointGetBatchRun = "batch-run/{n}"
+	EndpointBatchRuns   = "batch-runs"
+	EndpointTestCases   = "test-cases"
+	EndpointStopBatch   = "batch-run/{n}/stop"
+	EndpointArtifacts   = "batch-run/{n}/artifacts"
+	EndpointDownload    = "files"
+)
+
+// Fault : Failure returned instead of the normal response
+type Fault struct {
+	// StatusCode of the response. 0 means 500
+	StatusCode int `json:"status_code"`
+	// Detail is returned as `{"detail": "..."}` like ErrorResponse
+	Detail string `json:"detail"`
+	// FieldErrors is returned as `{"field": ["message", ...]}`
+	FieldErrors map[string][]string `json:"field_errors"`
+	// Body is returned as is when neither Detail nor FieldErrors is set (e.g. HTML error page)
+	Body string `json:"body"`
+	// RetryAfter is sent as `Retry-After` header in seconds when it is not 0
+	RetryAfter int `json:"retry_after"`
+	// CloseConnection closes the connection without any response to simulate network failure
+	CloseConnection bool `json:"close_connection"`
+}
+
+// Scenario : Scripted behavior of the fake server
+type Scenario struct {
+	// Statuses are returned by each call of batch-run/{n}/ in order, and the last one is repeated.
+	// Empty means ["succeeded"]
+	Statuses []string `json:"statuses"`
+	// TestCases is returned as the counts of every batch run
+	TestCases magicpod.TestCases `json:"test_cases"`
+	// Results are returned as TestCases.Details of finished batch runs, filtered by `test_case_numbers` of the batch run.
+	// The counts of TestCases are calculated from them if TestCases is not given
+	Results []magicpod.TestCaseResult `json:"results"`
+	// BatchRunResults overrides Results for the batch run number, e.g. to make a rerun succeed
+	BatchRunResults map[int][]magicpod.TestCaseResult `json:"batch_run_results"`
+	// TestCaseList is returned by test-cases/
+	TestCaseList []magicpod.TestCase `json:"test_case_list"`
+	// Artifacts are returned by batch-run/{n}/artifacts/ with URL of the fake server.
+	// Their content is Size bytes, or 1024 bytes when Size is 0 (unknown)
+	Artifacts []magicpod.Artifact `json:"artifacts"`
+	// RetryAfter is sent as `Retry-After` header of batch-run/{n}/ in seconds when it is not 0
+	RetryAfter int `json:"retry_after"`
+	// Latency is added to every response
+	Latency time.Duration `json:"-"`
+	// Faults are consumed one by one by the requests to each endpoint. A nil element lets the request succeed
+	Faults map[string][]*Fault `json:"faults"`
+	// Token is compared with the Authorization header when it is not empty
+	Token string `json:"-"`
+}
+
+type batchRun struct {
+	magicpod.BatchRun
+	params   map[string]interface{}
+	getCount int
+	stopped  bool
+}
+
+// Server : Fake Magic Pod Web API server. It implements http.Handler
+type Server struct {
+	mu         sync.Mutex
+	scenario   Scenario
+	faults     map[string][]*Fault
+	fileNames  []string
+	batchRuns  []*batchRun
+	requestLog []string
+}
+
+// New : Create a fake server which behaves as the scenario
+func New(scenario Scenario) *Server {
+	faults := map[string][]*Fault{}
+	for endpoint, list := range scenario.Faults {
+		faults[endpoint] = append([]*Fault{}, list...)
+	}
+	if len(scenario.Statuses) == 0 {
+		scenario.Statuses = []string{"succeeded"}
+	}
+	if scenario.TestCases.Total == 0 {
+		scenario.TestCases = countResults(scenario.Results)
+	}
+	scenario.TestCases.Details = scenario.Results
+	return &Server{scenario: scenario, faults: faults}
+}
+
+func countResults(results []magicpod.TestCaseResult) magicpod.TestCases {
+	testCases := magicpod.TestCases{Details: results}
+	for _, result := range results {
+		switch result.Status {
+		case "succeeded":
+			testCases.Succeeded++
+		case "failed":
+			testCases.Failed++
+		case "unresolved":
+			testCases.Unresolved++
+		}
+		testCases.Total++
+	}
+	return testCases
+}
+
+// Test cases of the finished batch run. Results are filtered by `test_case_numbers` of the request
+func (s *Server) testCases(run *batchRun) magicpod.TestCases {
+	results, ok := s.scenario.BatchRunResults[run.BatchRunNumber]
+	if !ok {
+		if len(s.scenario.Results) == 0 {
+			return s.scenario.TestCases
+		}
+		results = s.scenario.Results
+	}
+	numbers, _ := run.params["test_case_numbers"].([]interface{})
+	if len(numbers) == 0 {
+		if !ok {
+			return s.scenario.TestCases
+		}
+		return countResults(results)
+	}
+	selected := map[int]bool{}
+	for _, number := range numbers {
+		if n, ok := number.(float64); ok {
+			selected[int(n)] = true
+		}
+	}
+	filtered := []magicpod.TestCaseResult{}
+	for _, result := range results {
+		if selected[result.Number] {
+			filtered = append(filtered, result)
+		}
+	}
+	return countResults(filtered)
+}
+
+// RequestLog : "METHOD path" of every request received so far
+func (s *Server) RequestLog() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requestLog...)
+}
+
+// UploadedFileNames : Names of the files received by upload-file API. File number n is at index n-1
+func (s *Server) UploadedFileNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.fileNames...)
+}
+
+// BatchRunParams : Request body received by batch-run API for the batch run number
+func (s *Server) BatchRunParams(batchRunNumber int) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if batchRunNumber < 1 || batchRunNumber > len(s.batchRuns) {
+		return nil
+	}
+	return s.batchRuns[batchRunNumber-1].params
+}
+
+// ServeHTTP : Route `.../{organization_name}/{project_name}/<endpoint>/` to each handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requestLog = append(s.requestLog, r.Method+" "+r.URL.Path)
+	latency := s.scenario.Latency
+	s.mu.Unlock()
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	if s.scenario.Token != "" && r.Header.Get("Authorization") != "Token "+s.scenario.Token {
+		writeJSON(w, http.StatusUnauthorized, magicpod.ErrorResponse{Detail: "Invalid token."})
+		return
+	}
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(segments) >= 3 && segments[len(segments)-1] == "upload-file" && r.Method == http.MethodPost:
+		if s.injectFault(w, EndpointUploadFile) {
+			return
+		}
+		s.uploadFile(w, r, segments[len(segments)-3], segments[len(segments)-2])
+	case len(segments) >= 4 && segments[len(segments)-2] == "upload-file" && r.Method == http.MethodGet:
+		if s.injectFault(w, EndpointGetFile) {
+			return
+		}
+		s.getUploadFile(w, r, segments[len(segments)-1])
+	case len(segments) >= 3 && segments[len(segments)-1] == "batch-run" && r.Method == http.MethodPost:
+		if s.injectFault(w, EndpointStartBatch) {
+			return
+		}
+		s.startBatchRun(w, r, segments[len(segments)-3], segments[len(segments)-2])
+	case len(segments) >= 4 && segments[len(segments)-2] == "batch-run" && r.Method == http.MethodGet:
+		if s.injectFault(w, EndpointGetBatchRun) {
+			return
+		}
+		s.getBatchRun(w, r, segments[len(segments)-1])
+	case len(segments) >= 3 && segments[len(segments)-1] == "test-cases" && r.Method == http.MethodGet:
+		if s.injectFault(w, EndpointTestCases) {
+			return
+		}
+		writeJSON(w, http.StatusOK, magicpod.TestCaseList{
+			OrganizationName: segments[len(segments)-3],
+			ProjectName:      segments[len(segments)-2],
+			TestCases:        append([]magicpod.TestCase{}, s.scenario.TestCaseList...),
+		})
+	case len(segments) >= 3 && segments[len(segments)-1] == "batch-runs" && r.Method == http.MethodGet:
+		if s.injectFault(w, EndpointBatchRuns) {
+			return
+		}
+		s.listBatchRuns(w, r, segments[len(segments)-3], segments[len(segments)-2])
+	case len(segments) >= 5 && segments[len(segments)-3] == "batch-run" && segments[len(segments)-1] == "stop" && r.Method == http.MethodPost:
+		if s.injectFault(w, EndpointStopBatch) {
+			return
+		}
+		s.stopBatchRun(w, r, segments[len(segments)-2])
+	case len(segments) >= 5 && segments[len(segments)-3] == "batch-run" && segments[len(segments)-1] == "artifacts" && r.Method == http.MethodGet:
+		if s.injectFault(w, EndpointArtifacts) {
+			return
+		}
+		s.listArtifacts(w, r, segments[len(segments)-2])
+	case len(segments) == 2 && segments[0] == "files" && r.Method == http.MethodGet:
+		if s.injectFault(w, EndpointDownload) {
+			return
+		}
+		s.downloadFile(w, r, segments[1])
+	default:
+		writeJSON(w, http.StatusNotFound, magicpod.ErrorResponse{Detail: "Not found."})
+	}
+}
+
+// Returns true when a fault is injected and the response has already been written
+func (s *Server) injectFault(w http.ResponseWriter, endpoint string) bool {
+	s.mu.Lock()
+	var fault *Fault
+	if list := s.faults[endpoint]; len(list) > 0 {
+		fault = list[0]
+		s.faults[endpoint] = list[1:]
+	}
+	s.mu.Unlock()
+	if fault == nil {
+		return false
+	}
+
+	if fault.CloseConnection {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return true
+			}
+		}
+	}
+	statusCode := fault.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusInternalServerError
+	}
+	if fault.RetryAfter != 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(fault.RetryAfter))
+	}
+	switch {
+	case fault.Detail != "":
+		writeJSON(w, statusCode, magicpod.ErrorResponse{Detail: fault.Detail})
+	case len(fault.FieldErrors) != 0:
+		writeJSON(w, statusCode, fault.FieldErrors)
+	default:
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(statusCode)
+		fmt.Fprint(w, fault.Body)
+	}
+	return true
+}
+
+func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request, organizationName, projectName string) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"file": {"No file was submitted."}})
+		return
+	}
+	defer file.Close()
+	if _, err := ioutil.ReadAll(file); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"file": {err.Error()}})
+		return
+	}
+
+	s.mu.Lock()
+	s.fileNames = append(s.fileNames, header.Filename)
+	fileNo := len(s.fileNames)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, magicpod.UploadFile{FileName: header.Filename, FileNo: fileNo})
+}
+
+func (s *Server) getUploadFile(w http.ResponseWriter, r *http.Request, number string) {
+	fileNo, err := strconv.Atoi(number)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil || fileNo < 1 || fileNo > len(s.fileNames) {
+		writeJSON(w, http.StatusNotFound, magicpod.ErrorResponse{Detail: "Not found."})
+		return
+	}
+	writeJSON(w, http.StatusOK, magicpod.UploadFile{FileName: s.fileNames[fileNo-1], FileNo: fileNo})
+}
+
+func (s *Server) startBatchRun(w http.ResponseWriter, r *http.Request, organizationName, projectName string) {
+	var params map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeJSON(w, http.StatusBadRequest, magicpod.ErrorResponse{Detail: "JSON parse error - " + err.Error()})
+		return
+	}
+	fieldErrors := map[string][]string{}
+	for _, key := range []string{"environment", "os", "device_type", "app_type"} {
+		if value, ok := params[key].(string); !ok || value == "" {
+			fieldErrors[key] = []string{"This field is required."}
+		}
+	}
+	if params["app_type"] == "app_file" {
+		s.mu.Lock()
+		fileCount := len(s.fileNames)
+		s.mu.Unlock()
+		if fileNo, ok := params["app_file_number"].(float64); !ok || int(fileNo) < 1 || int(fileNo) > fileCount {
+			fieldErrors["app_file_number"] = []string{"Invalid app file number."}
+		}
+	}
+	if len(fieldErrors) != 0 {
+		writeJSON(w, http.StatusBadRequest, fieldErrors)
+		return
+	}
+
+	s.mu.Lock()
+	run := &batchRun{
+		BatchRun: magicpod.BatchRun{
+			Organizationname: organizationName,
+			ProjectName:      projectName,
+			BatchRunNumber:   len(s.batchRuns) + 1,
+			Status:           "running",
+			TestCases:        magicpod.TestCases{Total: s.scenario.TestCases.Total},
+		},
+		params: params,
+	}
+	run.URL = fmt.Sprintf("http://%s/%s/%s/batch-run/%d/", r.Host, organizationName, projectName, run.BatchRunNumber)
+	s.batchRuns = append(s.batchRuns, run)
+	resp := run.BatchRun
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) getBatchRun(w http.ResponseWriter, r *http.Request, number string) {
+	batchRunNumber, err := strconv.Atoi(number)
+	s.mu.Lock()
+	if err != nil || batchRunNumber < 1 || batchRunNumber > len(s.batchRuns) {
+		s.mu.Unlock()
+		writeJSON(w, http.StatusNotFound, magicpod.ErrorResponse{Detail: "Not found."})
+		return
+	}
+	run := s.batchRuns[batchRunNumber-1]
+	statuses := s.scenario.Statuses
+	if run.stopped {
+		run.Status = "aborted"
+	} else if run.getCount < len(statuses) {
+		run.Status = statuses[run.getCount]
+	} else {
+		run.Status = statuses[len(statuses)-1]
+	}
+	run.getCount++
+	if run.Status != "running" {
+		run.TestCases = s.testCases(run)
+	}
+	resp := run.BatchRun
+	retryAfter := s.scenario.RetryAfter
+	s.mu.Unlock()
+	if retryAfter != 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) listBatchRuns(w http.ResponseWriter, r *http.Request, organizationName, projectName string) {
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count <= 0 {
+		count = 20
+	}
+	s.mu.Lock()
+	resp := magicpod.BatchRuns{OrganizationName: organizationName, ProjectName: projectName, BatchRuns: []magicpod.BatchRun{}}
+	for i := len(s.batchRuns) - 1; i >= 0 && len(resp.BatchRuns) < count; i-- {
+		run := s.batchRuns[i].BatchRun
+		run.TestCases.Details = nil
+		resp.BatchRuns = append(resp.BatchRuns, run)
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) stopBatchRun(w http.ResponseWriter, r *http.Request, number string) {
+	batchRunNumber, err := strconv.Atoi(number)
+	s.mu.Lock()
+	if err != nil || batchRunNumber < 1 || batchRunNumber > len(s.batchRuns) {
+		s.mu.Unlock()
+		writeJSON(w, http.StatusNotFound, magicpod.ErrorResponse{Detail: "Not found."})
+		return
+	}
+	run := s.batchRuns[batchRunNumber-1]
+	run.stopped = true
+	run.Status = "aborted"
+	resp := run.BatchRun
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) listArtifacts(w http.ResponseWriter, r *http.Request, number string) {
+	batchRunNumber, err := strconv.Atoi(number)
+	s.mu.Lock()
+	if err != nil || batchRunNumber < 1 || batchRunNumber > len(s.batchRuns) {
+		s.mu.Unlock()
+		writeJSON(w, http.StatusNotFound, magicpod.ErrorResponse{Detail: "Not found."})
+		return
+	}
+	artifacts := []magicpod.Artifact{}
+	for i, artifact := range s.scenario.Artifacts {
+		if artifact.URL == "" {
+			artifact.URL = fmt.Sprintf("http://%s/files/%d", r.Host, i)
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, artifacts)
+}
+
+func (s *Server) downloadFile(w http.ResponseWriter, r *http.Request, index string) {
+	i, err := strconv.Atoi(index)
+	if err != nil || i < 0 || i >= len(s.scenario.Artifacts) {
+		writeJSON(w, http.StatusNotFound, magicpod.ErrorResponse{Detail: "Not found."})
+		return
+	}
+	size := s.scenario.Artifacts[i].Size
+	if size == 0 {
+		size = 1024
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	w.Write(bytes.Repeat([]byte{'x'}, int(size)))
+}
+
+// BatchRunStopped : Whether batch-run/{n}/stop/ API has been called for the batch run number
+func (s *Server) BatchRunStopped(batchRunNumber int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return batchRunNumber >= 1 && batchRunNumber <= len(s.batchRuns) && s.batchRuns[batchRunNumber-1].stopped
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
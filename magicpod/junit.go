@@ -0,0 +1,95 @@
+package magicpod
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+type junitTestSuites struct {
+	XMLName    xml.Name         `xml:"testsuites"`
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Time       string           `xml:"time,attr"`
+	TestSuites []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnitXML : Write result of each test case of the finished batch run as JUnit XML.
+// Failed test cases are reported as <failure> and unresolved ones as <error>, with their message and URL
+func WriteJUnitXML(w io.Writer, batchRun *BatchRun) error {
+	suite := junitTestSuite{
+		Name: fmt.Sprintf("%s/%s batch run #%d", batchRun.Organizationname, batchRun.ProjectName, batchRun.BatchRunNumber),
+	}
+	duration := 0.0
+	for _, result := range batchRun.TestCases.Details {
+		testCase := junitTestCase{
+			Name:      fmt.Sprintf("#%d %s", result.Number, result.Name),
+			ClassName: batchRun.ProjectName,
+			Time:      formatSeconds(result.Duration),
+		}
+		url := result.URL
+		if url == "" {
+			url = batchRun.URL
+		}
+		switch result.Status {
+		case "failed":
+			testCase.Failure = &junitFailure{Message: result.Message, Type: "failed", Body: result.Message + "\n" + url}
+			suite.Failures++
+		case "unresolved":
+			testCase.Error = &junitFailure{Message: result.Message, Type: "unresolved", Body: result.Message + "\n" + url}
+			suite.Errors++
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+		suite.Tests++
+		duration += result.Duration
+	}
+	suite.Time = formatSeconds(duration)
+
+	suites := junitTestSuites{
+		Name:       "Magic Pod",
+		Tests:      suite.Tests,
+		Failures:   suite.Failures,
+		Errors:     suite.Errors,
+		Time:       suite.Time,
+		TestSuites: []junitTestSuite{suite},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func formatSeconds(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
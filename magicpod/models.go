@@ -0,0 +1,124 @@
+package magicpod
+
+// UploadFile : Response from upload-file API
+type UploadFile struct {
+	FileName string `json:"file_name"`
+	FileNo   int    `json:"file_no"`
+}
+
+// TestCases : Part of response from batch-run API. It stands for number of test cases
+// and has result of each test case in Details once the batch run is finished
+type TestCases struct {
+	Succeeded  int              `json:"succeeded"`
+	Failed     int              `json:"failed"`
+	Unresolved int              `json:"unresolved"`
+	Total      int              `json:"total"`
+	Details    []TestCaseResult `json:"details"`
+}
+
+// TestCaseResult : Result of each test case in the batch run
+type TestCaseResult struct {
+	Number     int     `json:"number"`
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	RetryCount int     `json:"retry_count"` // how many times the test case was retried by `retry_count` parameter
+	Duration   float64 `json:"duration"`    // in seconds
+	Message    string  `json:"message"`     // error message when the test case is failed or unresolved
+	URL        string  `json:"url"`
+}
+
+// TestCaseNumbers : Numbers of the test cases which have the status in the finished batch run
+func (batchRun *BatchRun) TestCaseNumbers(status string) []int {
+	numbers := []int{}
+	for _, result := range batchRun.TestCases.Details {
+		if result.Status == status {
+			numbers = append(numbers, result.Number)
+		}
+	}
+	return numbers
+}
+
+// BatchRun : Response from batch-run API
+type BatchRun struct {
+	Organizationname string    `json:"organization_name"`
+	ProjectName      string    `json:"project_name"`
+	BatchRunNumber   int       `json:"batch_run_number"`
+	Status           string    `json:"status"`
+	TestCases        TestCases `json:"test_cases"`
+	URL              string    `json:"url"`
+}
+
+// BatchRuns : Response from batch-runs API
+type BatchRuns struct {
+	OrganizationName string     `json:"organization_name"`
+	ProjectName      string     `json:"project_name"`
+	BatchRuns        []BatchRun `json:"batch_runs"`
+}
+
+// MergeRerun : Result of the batch run whose test cases are replaced with the results of the rerun of them.
+// The counts are recalculated, and the status follows the merged results: `succeeded` when no test case is failed
+// or unresolved, `unresolved` when only unresolved ones remain, and `failed` when any failed one remains.
+// Other statuses such as `aborted` are kept unless all test cases succeeded
+func MergeRerun(original, rerun *BatchRun) *BatchRun {
+	rerunResults := map[int]TestCaseResult{}
+	for _, result := range rerun.TestCases.Details {
+		rerunResults[result.Number] = result
+	}
+	merged := *original
+	merged.TestCases = TestCases{Details: make([]TestCaseResult, len(original.TestCases.Details))}
+	for i, result := range original.TestCases.Details {
+		if rerunResult, ok := rerunResults[result.Number]; ok {
+			result = rerunResult
+		}
+		merged.TestCases.Details[i] = result
+		switch result.Status {
+		case "succeeded":
+			merged.TestCases.Succeeded++
+		case "failed":
+			merged.TestCases.Failed++
+		case "unresolved":
+			merged.TestCases.Unresolved++
+		}
+		merged.TestCases.Total++
+	}
+	switch {
+	case merged.TestCases.Failed == 0 && merged.TestCases.Unresolved == 0:
+		merged.Status = "succeeded"
+	case original.Status != "failed" && original.Status != "unresolved":
+		// Kept as it is, e.g. `aborted`
+	case merged.TestCases.Failed == 0:
+		merged.Status = "unresolved"
+	default:
+		merged.Status = "failed"
+	}
+	return &merged
+}
+
+// TestCase : Test case of the project
+type TestCase struct {
+	Number int      `json:"number"`
+	Name   string   `json:"name"`
+	Folder string   `json:"folder"` // path of the folder separated by `/`, or empty at the top level
+	Labels []string `json:"labels"`
+}
+
+// TestCaseList : Response from test-cases API
+type TestCaseList struct {
+	OrganizationName string     `json:"organization_name"`
+	ProjectName      string     `json:"project_name"`
+	TestCases        []TestCase `json:"test_cases"`
+}
+
+// ErrorResponse : Response from APIs when they are not finished with status 200
+type ErrorResponse struct {
+	Detail string `json:"detail"`
+}
+
+// Artifact : Screenshot, video or device log recorded in the batch run
+type Artifact struct {
+	TestCaseNumber int    `json:"test_case_number"`
+	Type           string `json:"type"` // screenshot, video or device_log
+	FileName       string `json:"file_name"`
+	Size           int64  `json:"size"` // in bytes, 0 when unknown
+	URL            string `json:"url"`
+}
@@ -0,0 +1,71 @@
+package magicpod
+
+import (
+	"reflect"
+	"testing"
+)
+
+func results(statuses ...string) []TestCaseResult {
+	list := []TestCaseResult{}
+	for i, status := range statuses {
+		list = append(list, TestCaseResult{Number: i + 1, Status: status})
+	}
+	return list
+}
+
+func TestMergeRerun(t *testing.T) {
+	tests := []struct {
+		name     string
+		original *BatchRun
+		rerun    []TestCaseResult
+		status   string
+		counts   TestCases
+	}{
+		{"all succeeded by rerun",
+			&BatchRun{Status: "failed", TestCases: TestCases{Details: results("succeeded", "failed", "unresolved")}},
+			[]TestCaseResult{{Number: 2, Status: "succeeded"}, {Number: 3, Status: "succeeded"}},
+			"succeeded", TestCases{Succeeded: 3, Total: 3}},
+		{"failed remains",
+			&BatchRun{Status: "failed", TestCases: TestCases{Details: results("succeeded", "failed", "unresolved")}},
+			[]TestCaseResult{{Number: 2, Status: "failed"}, {Number: 3, Status: "succeeded"}},
+			"failed", TestCases{Succeeded: 2, Failed: 1, Total: 3}},
+		{"only unresolved remains",
+			&BatchRun{Status: "failed", TestCases: TestCases{Details: results("succeeded", "failed", "unresolved")}},
+			[]TestCaseResult{{Number: 2, Status: "succeeded"}, {Number: 3, Status: "unresolved"}},
+			"unresolved", TestCases{Succeeded: 2, Unresolved: 1, Total: 3}},
+		{"failed by rerun of unresolved",
+			&BatchRun{Status: "unresolved", TestCases: TestCases{Details: results("succeeded", "unresolved")}},
+			[]TestCaseResult{{Number: 2, Status: "failed"}},
+			"failed", TestCases{Succeeded: 1, Failed: 1, Total: 2}},
+		{"not rerun test case is kept",
+			&BatchRun{Status: "failed", TestCases: TestCases{Details: results("failed", "failed")}},
+			[]TestCaseResult{{Number: 2, Status: "succeeded"}},
+			"failed", TestCases{Succeeded: 1, Failed: 1, Total: 2}},
+		{"aborted is kept",
+			&BatchRun{Status: "aborted", TestCases: TestCases{Details: results("succeeded", "failed")}},
+			[]TestCaseResult{{Number: 2, Status: "unresolved"}},
+			"aborted", TestCases{Succeeded: 1, Unresolved: 1, Total: 2}},
+		{"unknown test case of rerun is ignored",
+			&BatchRun{Status: "failed", TestCases: TestCases{Details: results("failed")}},
+			[]TestCaseResult{{Number: 1, Status: "succeeded"}, {Number: 9, Status: "failed"}},
+			"succeeded", TestCases{Succeeded: 1, Total: 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			original := *test.original
+			originalDetails := append([]TestCaseResult{}, original.TestCases.Details...)
+			merged := MergeRerun(&original, &BatchRun{Status: "failed", TestCases: TestCases{Details: test.rerun}})
+			if merged.Status != test.status {
+				t.Errorf("status = %s, want %s", merged.Status, test.status)
+			}
+			counts := merged.TestCases
+			counts.Details = nil
+			if !reflect.DeepEqual(counts, test.counts) {
+				t.Errorf("counts = %+v, want %+v", counts, test.counts)
+			}
+			if !reflect.DeepEqual(original.TestCases.Details, originalDetails) {
+				t.Errorf("original is modified: %+v", original.TestCases.Details)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package magicpod
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// UploadOptions : How to upload an app file by UploadFileWithOptions
+type UploadOptions struct {
+	// Retries is the number of retries on network errors and 5xx responses
+	Retries int
+	// RetryWait before the first retry, doubled for every retry. 0 means 5 seconds
+	RetryWait time.Duration
+	// Timeout of each attempt. 0 means no timeout
+	Timeout time.Duration
+	// OnProgress is called while the file is being sent, with the bytes sent so far and the total bytes of the request
+	OnProgress func(sent, total int64)
+	// OnRetry is called before waiting for a retry
+	OnRetry func(attempt int, wait time.Duration, err error)
+}
+
+// UploadFileWithOptions : Same as UploadFile, but streams the file without loading it into memory,
+// reports the progress and retries on transient errors
+func (c *Client) UploadFileWithOptions(filePath string, opts UploadOptions) (*UploadFile, error) {
+	wait := opts.RetryWait
+	if wait <= 0 {
+		wait = 5 * time.Second
+	}
+	for attempt := 0; ; attempt++ {
+		uploadFile, err := c.uploadFileOnce(filePath, opts)
+		if err == nil || attempt >= opts.Retries || !isTransient(err) {
+			return uploadFile, err
+		}
+		if apiErr, ok := err.(*APIError); ok && apiErr.RetryAfter > wait {
+			wait = apiErr.RetryAfter
+		}
+		if opts.OnRetry != nil {
+			opts.OnRetry(attempt+1, wait, err)
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// Network errors, 429 and 5xx responses can succeed by retrying, but a response which cannot be decoded cannot
+func isTransient(err error) bool {
+	switch err := err.(type) {
+	case *RequestError:
+		return true
+	case *APIError:
+		return err.StatusCode == http.StatusTooManyRequests || err.StatusCode >= 500
+	default:
+		return false
+	}
+}
+
+func (c *Client) uploadFileOnce(filePath string, opts UploadOptions) (*UploadFile, error) {
+	const op = "upload-file"
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Multipart body is built as head + file + tail so that its length is known without reading the file
+	var head bytes.Buffer
+	writer := multipart.NewWriter(&head)
+	if _, err := writer.CreateFormFile("file", filepath.Base(filePath)); err != nil {
+		return nil, err
+	}
+	headLength := int64(head.Len())
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	tail := append([]byte{}, head.Bytes()[headLength:]...)
+	head.Truncate(int(headLength))
+	total := headLength + info.Size() + int64(len(tail))
+
+	body := &progressReader{
+		reader:     io.MultiReader(&head, file, bytes.NewReader(tail)),
+		total:      total,
+		onProgress: opts.OnProgress,
+	}
+	requestURL := c.rest.HostURL + "/" + url.PathEscape(c.organizationName) + "/" + url.PathEscape(c.projectName) + "/upload-file/"
+	request, err := http.NewRequest(http.MethodPost, requestURL, body)
+	if err != nil {
+		return nil, err
+	}
+	request.ContentLength = total
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	request.Header.Set("Authorization", "Token "+c.apiToken)
+	if opts.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+		defer cancel()
+		request = request.WithContext(ctx)
+	}
+
+	resp, err := c.rest.GetClient().Do(request)
+	if err != nil {
+		return nil, &RequestError{Op: op, Err: err}
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &RequestError{Op: op, Err: err}
+	}
+	if err := checkStatus(op, resp.StatusCode, resp.Status, resp.Header, respBody); err != nil {
+		return nil, err
+	}
+	var uploadFile UploadFile
+	if err := json.Unmarshal(respBody, &uploadFile); err != nil {
+		return nil, &DecodeError{Op: op, Err: err}
+	}
+	return &uploadFile, nil
+}
+
+type progressReader struct {
+	reader     io.Reader
+	sent       int64
+	total      int64
+	onProgress func(sent, total int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.sent += int64(n)
+	if r.onProgress != nil && n > 0 {
+		r.onProgress(r.sent, r.total)
+	}
+	return n, err
+}
@@ -0,0 +1,133 @@
+package magicpod
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WaitOptions : How to poll batch-run API until the batch run finishes
+type WaitOptions struct {
+	// Interval between polls. 0 means 15 seconds
+	Interval time.Duration
+	// Backoff doubles the interval after every poll up to MaxInterval, with +-20% jitter
+	Backoff     bool
+	MaxInterval time.Duration
+	// Timeout of the whole wait. 0 means no timeout, and then transient failures are retried only maxWaitFailures times in a row
+	Timeout time.Duration
+	// OnPoll is called with the batch run every time it is fetched
+	OnPoll func(batchRun *BatchRun)
+}
+
+// TimeoutError : Error returned when the batch run does not finish within WaitOptions.Timeout
+type TimeoutError struct {
+	BatchRun *BatchRun
+	Timeout  time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("batch run #%d did not finish within %s. Please see %s for detail",
+		e.BatchRun.BatchRunNumber, e.Timeout, e.BatchRun.URL)
+}
+
+// Consecutive transient failures retried by WaitBatchRun without WaitOptions.Timeout
+const maxWaitFailures = 5
+
+// WaitBatchRun : Poll the batch run until its status becomes other than `running`.
+// `Retry-After` sent by the server is honoured, and transient failures such as network errors, 429 and 5xx responses
+// are retried until the timeout instead of being returned as errors
+func (c *Client) WaitBatchRun(ctx context.Context, batchRunNumber int, opts WaitOptions) (*BatchRun, error) {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	var deadline time.Time
+	if opts.Timeout > 0 {
+		deadline = time.Now().Add(opts.Timeout)
+	}
+
+	var batchRun *BatchRun
+	failures := 0
+	for {
+		current, retryAfter, err := c.getBatchRun(batchRunNumber)
+		if err != nil {
+			failures++
+			if !isTransient(err) || (deadline.IsZero() && failures > maxWaitFailures) {
+				return batchRun, err
+			}
+			if apiErr, ok := err.(*APIError); ok {
+				retryAfter = apiErr.RetryAfter
+			}
+		} else {
+			failures = 0
+			batchRun = current
+			if opts.OnPoll != nil {
+				opts.OnPoll(batchRun)
+			}
+			if batchRun.Status != "running" {
+				return batchRun, nil
+			}
+		}
+
+		wait := interval
+		if opts.Backoff {
+			wait = addJitter(wait)
+			interval *= 2
+			if opts.MaxInterval > 0 && interval > opts.MaxInterval {
+				interval = opts.MaxInterval
+			}
+		}
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				if batchRun == nil {
+					batchRun = &BatchRun{BatchRunNumber: batchRunNumber, Status: "running"}
+				}
+				return batchRun, &TimeoutError{BatchRun: batchRun, Timeout: opts.Timeout}
+			}
+			if wait > remaining {
+				wait = remaining
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return batchRun, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func addJitter(d time.Duration) time.Duration {
+	jitter := int64(d) / 5
+	if jitter <= 0 {
+		return d
+	}
+	return d - time.Duration(jitter) + time.Duration(rand.Int63n(2*jitter))
+}
+
+// Parses Retry-After header, which is either of seconds or HTTP date
+func parseRetryAfter(header http.Header) time.Duration {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package step
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/appinfo"
+)
+
+// Fills `bundle_id` from Info.plist of `app_path` when it is empty and `app_path` is an iOS app
+func detectBundleID(cfg *Config) {
+	if cfg.OsName != "ios" || cfg.BundleID != "" || cfg.AppPath == "" {
+		return
+	}
+	ext := strings.ToLower(filepath.Ext(strings.TrimRight(cfg.AppPath, "/")))
+	if ext != ".app" && ext != ".ipa" {
+		return
+	}
+	bundleID, err := appinfo.IOSBundleID(cfg.AppPath)
+	if err != nil {
+		log.Warnf("Failed to detect bundle ID from %s: %s", cfg.AppPath, err)
+		return
+	}
+	log.Infof("Detected bundle ID %s from %s", bundleID, cfg.AppPath)
+	cfg.BundleID = bundleID
+	exportOutput(outputBundleID, bundleID)
+}
+
+// Fills `app_package` and `app_activity` from AndroidManifest.xml of `app_path` when they are empty and `app_path` is an APK
+func detectAndroidApp(cfg *Config) {
+	if cfg.OsName != "android" || (cfg.AppPackage != "" && cfg.AppActivity != "") || cfg.AppPath == "" {
+		return
+	}
+	if strings.ToLower(filepath.Ext(cfg.AppPath)) != ".apk" {
+		return
+	}
+	appPackage, appActivity, err := appinfo.AndroidPackageAndActivity(cfg.AppPath)
+	if err != nil && err != appinfo.ErrNoLauncherActivity {
+		log.Warnf("Failed to detect app package and activity from %s: %s", cfg.AppPath, err)
+		return
+	}
+	if cfg.AppPackage == "" {
+		log.Infof("Detected app package %s from %s", appPackage, cfg.AppPath)
+		cfg.AppPackage = appPackage
+		exportOutput(outputAppPackage, appPackage)
+	}
+	if cfg.AppActivity == "" {
+		if err != nil {
+			log.Warnf("Failed to detect app activity from %s: %s", cfg.AppPath, err)
+			return
+		}
+		log.Infof("Detected app activity %s from %s", appActivity, cfg.AppPath)
+		cfg.AppActivity = appActivity
+		exportOutput(outputAppActivity, appActivity)
+	}
+}
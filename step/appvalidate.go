@@ -0,0 +1,115 @@
+package step
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/appinfo"
+)
+
+// Checks `app_path` against `os` and `device_type` before uploading, because a wrong artifact is otherwise
+// reported by Magic Pod only after uploading and starting the batch run
+func validateAppFile(cfg Config) error {
+	if cfg.AppType != "app_file" {
+		return nil
+	}
+	appPath := strings.TrimRight(cfg.AppPath, "/")
+	if appPath == "" {
+		// Reported by validate()
+		return nil
+	}
+	info, err := os.Stat(appPath)
+	if err != nil {
+		return fmt.Errorf("App path %s does not exist", appPath)
+	}
+	ext := strings.ToLower(filepath.Ext(appPath))
+
+	switch cfg.OsName {
+	case "android":
+		return validateAPK(appPath, ext, info)
+	case "ios":
+		if cfg.DeviceType == "simulator" {
+			return validateSimulatorApp(appPath, ext, info)
+		}
+		return validateDeviceApp(appPath, ext, info)
+	}
+	return nil
+}
+
+func validateAPK(appPath, ext string, info os.FileInfo) error {
+	switch {
+	case ext == ".aab":
+		return fmt.Errorf("%s is an Android App Bundle, which cannot be installed on devices. "+
+			"Please specify an APK file built by e.g. `./gradlew assembleDebug`", appPath)
+	case info.IsDir() || ext != ".apk":
+		return fmt.Errorf("App path %s should be an .apk file for Android", appPath)
+	}
+	if _, err := appinfo.ReadAndroidManifest(appPath); err != nil {
+		return fmt.Errorf("%s is not a valid APK: %s", appPath, err)
+	}
+	return nil
+}
+
+func validateSimulatorApp(appPath, ext string, info os.FileInfo) error {
+	switch {
+	case ext == ".ipa":
+		return fmt.Errorf("%s is an IPA file for real devices. For Simulator, please specify the .app directory "+
+			"built for Simulator (e.g. `xcodebuild -sdk iphonesimulator`)", appPath)
+	case !info.IsDir() || ext != ".app":
+		return fmt.Errorf("App path %s should be an .app directory for Simulator", appPath)
+	}
+	files, err := ioutil.ReadDir(appPath)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("App directory %s is empty", appPath)
+	}
+	slices, err := appinfo.IOSExecutableSlices(appPath)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid iOS app: %s", appPath, err)
+	}
+	for _, slice := range slices {
+		if slice.Platform == "ios-simulator" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is built for %s, not for Simulator. Please build it with `-sdk iphonesimulator`",
+		appPath, formatMachOSlices(slices))
+}
+
+func validateDeviceApp(appPath, ext string, info os.FileInfo) error {
+	switch {
+	case ext == ".app":
+		return fmt.Errorf("%s is an .app directory. For Real Device, please specify an .ipa file "+
+			"exported by e.g. `xcodebuild -exportArchive`", appPath)
+	case info.IsDir() || ext != ".ipa":
+		return fmt.Errorf("App path %s should be an .ipa file for Real Device", appPath)
+	}
+	slices, err := appinfo.IOSExecutableSlices(appPath)
+	if err != nil {
+		return fmt.Errorf("%s is not a valid iOS app: %s", appPath, err)
+	}
+	for _, slice := range slices {
+		if slice.Platform == "ios" && strings.HasPrefix(slice.Arch, "arm") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is built for %s, not for real iOS devices. Please build it with `-sdk iphoneos`",
+		appPath, formatMachOSlices(slices))
+}
+
+func formatMachOSlices(slices []appinfo.MachOSlice) string {
+	formatted := make([]string, len(slices))
+	for i, slice := range slices {
+		platform := slice.Platform
+		if platform == "" {
+			platform = "unknown platform"
+		}
+		formatted[i] = fmt.Sprintf("%s (%s)", platform, slice.Arch)
+	}
+	return strings.Join(formatted, ", ")
+}
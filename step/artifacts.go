@@ -0,0 +1,198 @@
+package step
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+var errArtifactSizeLimit = errors.New("total size limit of artifacts is exceeded")
+
+// Total size of downloaded artifacts shared by concurrent downloads
+type artifactSizeBudget struct {
+	mu        sync.Mutex
+	limit     int64 // 0 means no limit
+	remaining int64
+}
+
+// Reserves n bytes, and returns false if they exceed the limit
+func (budget *artifactSizeBudget) reserve(n int64) bool {
+	if budget.limit == 0 {
+		return true
+	}
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	if n > budget.remaining {
+		return false
+	}
+	budget.remaining -= n
+	return true
+}
+
+// Gives back n bytes reserved for the artifact which was not downloaded after all
+func (budget *artifactSizeBudget) refund(n int64) {
+	if budget.limit == 0 || n <= 0 {
+		return
+	}
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	budget.remaining += n
+}
+
+// Writer which consumes the budget as it is written. The declared size of the artifact is reserved in advance,
+// and only the bytes beyond it are reserved while writing, because the declared size may be wrong
+type budgetWriter struct {
+	file     *os.File
+	budget   *artifactSizeBudget
+	reserved int64 // bytes reserved from the budget for this artifact
+	written  int64
+}
+
+func (w *budgetWriter) Write(p []byte) (int, error) {
+	if excess := w.written + int64(len(p)) - w.reserved; excess > 0 {
+		if !w.budget.reserve(excess) {
+			return 0, errArtifactSizeLimit
+		}
+		w.reserved += excess
+	}
+	n, err := w.file.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Returns whether artifacts of the test case with the status should be downloaded in `download_artifacts` mode
+func shouldDownloadArtifacts(mode, status string) bool {
+	switch mode {
+	case "all":
+		return true
+	case "failed":
+		return status == "failed" || status == "unresolved"
+	default:
+		return false
+	}
+}
+
+// Downloads screenshots, videos and device logs of the finished batch run into
+// `<deploy_dir>/magicpod/<batch_run_number>/<test_case_number>/` so that they are attached to the build.
+// Returns the directory of the batch run, or empty when nothing is downloaded
+func downloadArtifacts(cfg Config, client *magicpod.Client, batchRun *magicpod.BatchRun) string {
+	if cfg.DownloadArtifacts == "none" {
+		return ""
+	}
+	if cfg.DeployDir == "" {
+		log.Warnf("Artifacts are not downloaded because BITRISE_DEPLOY_DIR is empty")
+		return ""
+	}
+	artifacts, err := client.ListArtifacts(batchRun.BatchRunNumber)
+	if err != nil {
+		log.Warnf("Failed to list artifacts, error: %s", err)
+		return ""
+	}
+	statuses := map[int]string{}
+	for _, result := range batchRun.TestCases.Details {
+		statuses[result.Number] = result.Status
+	}
+	targets := []magicpod.Artifact{}
+	for _, artifact := range artifacts {
+		if shouldDownloadArtifacts(cfg.DownloadArtifacts, statuses[artifact.TestCaseNumber]) {
+			targets = append(targets, artifact)
+		}
+	}
+	if len(targets) == 0 {
+		return ""
+	}
+
+	baseDir := filepath.Join(cfg.DeployDir, "magicpod", strconv.Itoa(batchRun.BatchRunNumber))
+	log.Infof("Download %d artifacts into %s", len(targets), baseDir)
+	budget := &artifactSizeBudget{
+		limit:     int64(cfg.DownloadMaxSizeMB) * 1024 * 1024,
+		remaining: int64(cfg.DownloadMaxSizeMB) * 1024 * 1024,
+	}
+	concurrency := cfg.DownloadConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	queue := make(chan magicpod.Artifact)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	downloaded, skipped := 0, 0
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for artifact := range queue {
+				err := downloadArtifact(client, artifact, baseDir, budget)
+				mu.Lock()
+				if err != nil {
+					log.Warnf("Failed to download %s of test case #%d, error: %s", artifact.FileName, artifact.TestCaseNumber, err)
+					skipped++
+				} else {
+					downloaded++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, artifact := range targets {
+		queue <- artifact
+	}
+	close(queue)
+	wg.Wait()
+
+	log.Donef("Downloaded %d artifacts (%d skipped)", downloaded, skipped)
+	return baseDir
+}
+
+func downloadArtifact(client *magicpod.Client, artifact magicpod.Artifact, baseDir string, budget *artifactSizeBudget) error {
+	writer := &budgetWriter{budget: budget}
+	if artifact.Size > 0 {
+		if !budget.reserve(artifact.Size) {
+			return errArtifactSizeLimit
+		}
+		writer.reserved = artifact.Size
+	}
+	err := writeArtifact(client, artifact, baseDir, writer)
+	if err != nil {
+		budget.refund(writer.reserved)
+	} else {
+		// The artifact can be smaller than declared
+		budget.refund(writer.reserved - writer.written)
+	}
+	return err
+}
+
+func writeArtifact(client *magicpod.Client, artifact magicpod.Artifact, baseDir string, writer *budgetWriter) error {
+	dir := filepath.Join(baseDir, strconv.Itoa(artifact.TestCaseNumber))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	fileName := filepath.Base(artifact.FileName)
+	if fileName == "." || fileName == string(filepath.Separator) {
+		fileName = fmt.Sprintf("%s-%d", artifact.Type, artifact.TestCaseNumber)
+	}
+	path := filepath.Join(dir, fileName)
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	writer.file = file
+	_, err = client.DownloadArtifact(artifact, writer)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		if requestErr, ok := err.(*magicpod.RequestError); ok && requestErr.Err == errArtifactSizeLimit {
+			return errArtifactSizeLimit
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package step
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+func TestDownloadArtifactBudget(t *testing.T) {
+	// /<size> serves the file of the size regardless of the declared one
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, err := strconv.Atoi(r.URL.Path[1:])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(bytes.Repeat([]byte{'x'}, size))
+	}))
+	t.Cleanup(server.Close)
+	client := magicpod.NewClient(server.URL+"/api/v1.0", "", "Org", "Prj", nil)
+
+	tests := []struct {
+		name      string
+		declared  int64
+		path      string
+		err       bool
+		remaining int64
+	}{
+		{"declared size", 10, "/10", false, 40},
+		{"smaller than declared", 10, "/5", false, 45},
+		{"unknown size", 0, "/20", false, 30},
+		{"larger than declared", 10, "/30", false, 20},
+		{"larger than declared over limit", 10, "/100", true, 50},
+		{"declared over limit", 100, "/10", true, 50},
+		{"unknown size over limit", 0, "/100", true, 50},
+		{"failed download", 10, "/missing", true, 50},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			budget := &artifactSizeBudget{limit: 50, remaining: 50}
+			artifact := magicpod.Artifact{TestCaseNumber: 1, Type: "video", FileName: "video.mp4", Size: test.declared, URL: server.URL + test.path}
+			err := downloadArtifact(client, artifact, dir, budget)
+			if (err != nil) != test.err {
+				t.Errorf("downloadArtifact() error = %v, want error = %v", err, test.err)
+			}
+			if budget.remaining != test.remaining {
+				t.Errorf("remaining = %d, want %d", budget.remaining, test.remaining)
+			}
+			_, statErr := os.Stat(filepath.Join(dir, "1", "video.mp4"))
+			if exists := statErr == nil; exists == test.err {
+				t.Errorf("file exists = %v after error = %v", exists, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package step
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+// Keeps the batch runs started by this step so that they can be cancelled when the step is aborted or timed out
+type batchRunCanceller struct {
+	mu              sync.Mutex
+	client          *magicpod.Client
+	enabled         bool
+	batchRunNumbers []int // batch runs which are started and not cancelled yet
+}
+
+// Cancel the batch runs when this step receives SIGINT or SIGTERM (e.g. Bitrise build is aborted)
+func trapAbortSignals(canceller *batchRunCanceller) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Warnf("\nReceived %s", sig)
+		canceller.cancel()
+		os.Exit(1)
+	}()
+}
+
+func (canceller *batchRunCanceller) addBatchRunNumber(batchRunNumber int) {
+	canceller.mu.Lock()
+	defer canceller.mu.Unlock()
+	canceller.batchRunNumbers = append(canceller.batchRunNumbers, batchRunNumber)
+}
+
+// Cancels all the batch runs. It does nothing if cancelling is disabled
+func (canceller *batchRunCanceller) cancel() {
+	canceller.mu.Lock()
+	batchRunNumbers := append([]int{}, canceller.batchRunNumbers...)
+	canceller.mu.Unlock()
+	for _, batchRunNumber := range batchRunNumbers {
+		canceller.cancelBatchRun(batchRunNumber)
+	}
+}
+
+// Cancels the batch run at most once. It does nothing if cancelling is disabled or the batch run is not started by this step
+func (canceller *batchRunCanceller) cancelBatchRun(batchRunNumber int) {
+	canceller.mu.Lock()
+	defer canceller.mu.Unlock()
+	index := -1
+	for i, number := range canceller.batchRunNumbers {
+		if number == batchRunNumber {
+			index = i
+		}
+	}
+	if !canceller.enabled || index == -1 {
+		return
+	}
+	canceller.batchRunNumbers = append(canceller.batchRunNumbers[:index], canceller.batchRunNumbers[index+1:]...)
+
+	log.Infof("Cancel batch run #%d", batchRunNumber)
+	if err := canceller.client.CancelBatchRun(batchRunNumber); err != nil {
+		log.Errorf("Failed to cancel batch run #%d: %s", batchRunNumber, err)
+	} else {
+		log.Donef("Batch run #%d has been cancelled", batchRunNumber)
+	}
+}
@@ -0,0 +1,95 @@
+package step
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+// Operations of the batch runs other than Run, used by the command line tool (cmd/magicpod).
+// Like Run, they take the configuration which is not converted to API params yet, and exit the process on errors
+
+// NewClient : Client of Magic Pod API for the configuration
+func NewClient(cfg Config) *magicpod.Client {
+	return createClient(cfg)
+}
+
+// Upload : Validates and uploads the app file of `app_path`, and returns its file number
+func Upload(cfg Config) int {
+	cfg.AppType = "App file (cloud upload)"
+	errors := cfg.convertToAPIParams()
+	if len(errors) == 0 {
+		useOutputSinks(cfg)
+		errors = cfg.validateAndDetect()
+	}
+	if len(errors) != 0 {
+		for i := range errors {
+			log.Errorf("- %s", errors[i].Error())
+		}
+		os.Exit(1)
+	}
+	fileNumber, err := uploadAppFile(cfg, createClient(cfg))
+	if err != nil {
+		failf(err.Error())
+	}
+	return fileNumber
+}
+
+// Status : Prints the current status and counts of the batch runs without waiting for them
+func Status(cfg Config, batchRunNumbers []int) {
+	client := createClient(cfg)
+	var builder strings.Builder
+	writer := tabwriter.NewWriter(&builder, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Batch run\tStatus\tSucceeded\tFailed\tUnresolved\tTotal\tURL")
+	for _, number := range batchRunNumbers {
+		batchRun, err := client.GetBatchRun(number)
+		if err != nil {
+			failf("Failed to get batch run #%d, error: %s", number, err)
+		}
+		testCases := batchRun.TestCases
+		fmt.Fprintf(writer, "#%d\t%s\t%d\t%d\t%d\t%d\t%s\n", number, batchRun.Status,
+			testCases.Succeeded, testCases.Failed, testCases.Unresolved, testCases.Total, batchRun.URL)
+	}
+	writer.Flush()
+	fmt.Print(builder.String())
+}
+
+// Cancel : Cancels the running batch runs. Finished ones are left as they are
+func Cancel(cfg Config, batchRunNumbers []int) {
+	client := createClient(cfg)
+	for _, number := range batchRunNumbers {
+		batchRun, err := client.GetBatchRun(number)
+		if err != nil {
+			failf("Failed to get batch run #%d, error: %s", number, err)
+		}
+		if batchRun.Status != "running" {
+			log.Printf("Batch run #%d has already finished as %s", number, batchRun.Status)
+			continue
+		}
+		if err := client.CancelBatchRun(number); err != nil {
+			failf("Failed to cancel batch run #%d, error: %s", number, err)
+		}
+		log.Donef("Batch run #%d is cancelled", number)
+	}
+}
+
+// Report : Reports the finished batch runs in the same way as Run with `mode: wait`, including the decision by the pass policy
+func Report(cfg Config, batchRunNumbers []int) {
+	client := createClient(cfg)
+	for _, number := range batchRunNumbers {
+		batchRun, err := client.GetBatchRun(number)
+		if err != nil {
+			failf("Failed to get batch run #%d, error: %s", number, err)
+		}
+		if batchRun.Status == "running" {
+			failf("Batch run #%d is still running. Please wait for it to finish", number)
+		}
+	}
+	cfg.Mode = "wait"
+	cfg.BatchRunNumbers = joinNumbers(batchRunNumbers)
+	Run(cfg)
+}
@@ -0,0 +1,108 @@
+package step
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+)
+
+// Inputs sent in the body of batch-run API which should not be printed
+var secretAPIParams = []string{"external_service_token", "external_service_password"}
+
+// Prints the requests which would be sent to Magic Pod API instead of sending them, and exits.
+// The app file is prepared (e.g. zipped) in the same way as the actual run, so that its problems are found as well
+func dryRun(cfg Config, matrixCfgs []Config, matrixNames []string) {
+	log.Warnf("Dry run: no request is sent to Magic Pod")
+	fmt.Println()
+	if cfg.Mode == "wait" {
+		for _, number := range cfg.BatchRunNumbersList {
+			printDryRunRequest("GET", apiURL(cfg, fmt.Sprintf("batch-run/%d/", number)), "", "")
+			fmt.Println()
+		}
+		log.Successf("Exit this step because 'Dry run' is set to true")
+		os.Exit(0)
+	}
+	if len(matrixCfgs) == 0 {
+		matrixCfgs, matrixNames = []Config{cfg}, []string{""}
+	}
+	for i := range matrixCfgs {
+		if matrixNames[i] != "" {
+			log.Infof("%s:", matrixNames[i])
+		}
+		if err := printDryRunRequests(matrixCfgs[i]); err != nil {
+			failf(err.Error())
+		}
+	}
+	log.Successf("Exit this step because 'Dry run' is set to true")
+	os.Exit(0)
+}
+
+func printDryRunRequests(cfg Config) error {
+	appFileNumber := -1
+	if cfg.AppType == "app_file" {
+		appPath, err := prepareAppFile(cfg)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(appPath)
+		if err != nil {
+			return err
+		}
+		printDryRunRequest("POST", apiURL(cfg, "upload-file/"), "multipart/form-data",
+			fmt.Sprintf("file=@%s (%d bytes)", appPath, info.Size()))
+		if cfg.UploadCacheDir != "" {
+			fmt.Println("(skipped if the identical file is found in the upload cache)")
+		}
+		fmt.Println()
+		appFileNumber = 0
+	}
+
+	params := createStartBatchRunParams(cfg, appFileNumber)
+	if cfg.AppType == "app_file" {
+		params["app_file_number"] = "<file number returned by upload-file>"
+	}
+	if cfg.RerunFailedFrom != "" {
+		params["test_case_numbers"] = fmt.Sprintf("<failed and unresolved test cases of batch run %s>", cfg.RerunFailedFrom)
+	}
+	if selection, _ := newTestCaseSelection(cfg); selection.enabled() {
+		params["test_case_numbers"] = "<test cases selected by names, folders and labels>"
+	}
+	if shard, _ := newShardConfig(cfg); shard.enabled() {
+		params["test_case_numbers"] = fmt.Sprintf("<test cases assigned to %s by %s>", shard, shard.strategy)
+	}
+	for _, key := range secretAPIParams {
+		if value, ok := params[key]; ok && fmt.Sprint(value) != "" {
+			params[key] = "[REDACTED]"
+		}
+	}
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(params); err != nil {
+		return err
+	}
+	printDryRunRequest("POST", apiURL(cfg, "batch-run/"), "application/json", strings.TrimSpace(body.String()))
+	fmt.Println()
+	return nil
+}
+
+func printDryRunRequest(method, requestURL, contentType, body string) {
+	fmt.Printf("%s %s\n", method, requestURL)
+	fmt.Println("Authorization: Token [REDACTED]")
+	if contentType == "" {
+		return
+	}
+	fmt.Printf("Content-Type: %s\n\n", contentType)
+	fmt.Println(body)
+}
+
+func apiURL(cfg Config, path string) string {
+	return strings.TrimRight(cfg.BaseURL, "/") + "/" + url.PathEscape(cfg.OrganizationName) + "/" +
+		url.PathEscape(cfg.ProjectName) + "/" + path
+}
@@ -0,0 +1,354 @@
+package step
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+	"gopkg.in/yaml.v2"
+)
+
+// DeviceEntry : One entry of `device_matrix` input, which is a YAML or JSON list. Empty fields inherit the values
+// of the step inputs, and the values are written in the same way as the step inputs (e.g. "iOS", "Real Device")
+type DeviceEntry struct {
+	Name           string `yaml:"name"`
+	Environment    string `yaml:"environment"`
+	OsName         string `yaml:"os"`
+	DeviceType     string `yaml:"device_type"`
+	Version        string `yaml:"version"`
+	Model          string `yaml:"model"`
+	AppPath        string `yaml:"app_path"`
+	AppURL         string `yaml:"app_url"`
+	BundleID       string `yaml:"bundle_id"`
+	AppPackage     string `yaml:"app_package"`
+	AppActivity    string `yaml:"app_activity"`
+	DeviceLanguage string `yaml:"device_language"`
+	DeviceRegion   string `yaml:"device_region"`
+}
+
+// One batch run started by this step, which is one entry of the device matrix
+type deviceRun struct {
+	name     string
+	cfg      Config
+	batchRun *magicpod.BatchRun
+	status   string // status of batchRun, or "error"/"timeout" decided by this step
+	err      error
+	decision passDecision
+
+	startedAt  time.Time
+	finishedAt time.Time
+}
+
+// Builds configurations of each device entry from the base one which is not converted to API params yet
+func parseDeviceMatrix(base Config) ([]Config, []string, error) {
+	// JSON is also parsed as YAML
+	var entries []DeviceEntry
+	if err := yaml.Unmarshal([]byte(base.DeviceMatrix), &entries); err != nil {
+		return nil, nil, fmt.Errorf("Device matrix should be a YAML or JSON list of device entries: %s", err)
+	}
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("Device matrix should have at least one device entry")
+	}
+	cfgs := make([]Config, len(entries))
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		cfg := base
+		override(&cfg.Environment, entry.Environment)
+		override(&cfg.OsName, entry.OsName)
+		override(&cfg.DeviceType, entry.DeviceType)
+		override(&cfg.Version, entry.Version)
+		override(&cfg.Model, entry.Model)
+		override(&cfg.AppPath, entry.AppPath)
+		override(&cfg.AppURL, entry.AppURL)
+		override(&cfg.BundleID, entry.BundleID)
+		override(&cfg.AppPackage, entry.AppPackage)
+		override(&cfg.AppActivity, entry.AppActivity)
+		override(&cfg.DeviceLanguage, entry.DeviceLanguage)
+		override(&cfg.DeviceRegion, entry.DeviceRegion)
+		cfgs[i] = cfg
+		names[i] = entry.Name
+		if names[i] == "" {
+			names[i] = fmt.Sprintf("%s %s (%s)", cfg.OsName, cfg.Model, cfg.Version)
+		}
+	}
+	return cfgs, names, nil
+}
+
+func override(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
+
+// Uploads app files (each distinct file only once) and starts batch runs of all devices concurrently.
+// Errors are kept in each deviceRun so that other devices can go on
+func startDeviceRuns(runs []*deviceRun, client *magicpod.Client, canceller *batchRunCanceller) {
+	reattached := map[*deviceRun]bool{}
+	hashes := map[string]string{}
+	for _, run := range runs {
+		// Devices sharing the app file read it only once
+		if hash, ok := hashes[run.cfg.AppPath]; ok {
+			run.cfg.AppContentHash = hash
+		} else {
+			run.cfg.hashApp()
+			hashes[run.cfg.AppPath] = run.cfg.AppContentHash
+		}
+		batchRun, started := findStartedBatchRun(run.cfg, client)
+		if batchRun == nil {
+			continue
+		}
+		reattached[run] = true
+		canceller.addBatchRunNumber(batchRun.BatchRunNumber)
+		run.batchRun, run.status, run.startedAt = batchRun, batchRun.Status, started.StartedAt
+		log.Donef("%s: reattached to batch run #%d (%s) started by the previous attempt of this step. You can check detail progress on %s",
+			run.name, batchRun.BatchRunNumber, batchRun.Status, batchRun.URL)
+	}
+
+	fileNumbers := map[string]int{}
+	uploadErrors := map[string]error{}
+	for _, run := range runs {
+		if run.cfg.AppType != "app_file" || reattached[run] {
+			continue
+		}
+		key := run.cfg.OsName + ":" + run.cfg.DeviceType + ":" + run.cfg.AppPath
+		if _, ok := fileNumbers[key]; ok {
+			continue
+		}
+		if _, ok := uploadErrors[key]; ok {
+			continue
+		}
+		log.Infof("%s:", run.name)
+		fileNumber, err := uploadAppFile(run.cfg, client)
+		if err != nil {
+			uploadErrors[key] = err
+		} else {
+			fileNumbers[key] = fileNumber
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		if reattached[run] {
+			continue
+		}
+		appFileNumber := -1
+		if run.cfg.AppType == "app_file" {
+			key := run.cfg.OsName + ":" + run.cfg.DeviceType + ":" + run.cfg.AppPath
+			if err, ok := uploadErrors[key]; ok {
+				run.status, run.err = "error", err
+				continue
+			}
+			appFileNumber = fileNumbers[key]
+		}
+		wg.Add(1)
+		go func(run *deviceRun, appFileNumber int) {
+			defer wg.Done()
+			run.startedAt = time.Now()
+			batchRun, err := client.StartBatchRun(createStartBatchRunParams(run.cfg, appFileNumber))
+			if err != nil {
+				run.status, run.err = "error", err
+				return
+			}
+			rememberStartedBatchRun(run.cfg, batchRun, appFileNumber, run.startedAt)
+			canceller.addBatchRunNumber(batchRun.BatchRunNumber)
+			run.batchRun, run.status = batchRun, batchRun.Status
+			log.Donef("%s: batch run #%d has started. You can check detail progress on %s",
+				run.name, batchRun.BatchRunNumber, batchRun.URL)
+		}(run, appFileNumber)
+	}
+	wg.Wait()
+	fmt.Println()
+}
+
+// Polls all started batch runs concurrently until they finish. Timed out batch runs are cancelled
+func waitDeviceRuns(cfg Config, runs []*deviceRun, client *magicpod.Client, canceller *batchRunCanceller) {
+	opts := magicpod.WaitOptions{
+		Interval:    time.Duration(cfg.PollInterval) * time.Second,
+		Backoff:     cfg.PollBackoff,
+		MaxInterval: time.Duration(cfg.MaxPollInterval) * time.Second,
+		Timeout:     time.Duration(cfg.MaxWaitTime) * time.Second,
+		OnPoll: func(*magicpod.BatchRun) {
+			print(".")
+		},
+	}
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		if run.batchRun == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(run *deviceRun) {
+			defer wg.Done()
+			finished, err := client.WaitBatchRun(context.Background(), run.batchRun.BatchRunNumber, opts)
+			run.finishedAt = time.Now()
+			if err != nil {
+				if timeoutErr, ok := err.(*magicpod.TimeoutError); ok {
+					run.batchRun, run.status = timeoutErr.BatchRun, "timeout"
+					canceller.cancelBatchRun(run.batchRun.BatchRunNumber)
+				} else {
+					run.status, run.err = "error", err
+				}
+				return
+			}
+			run.batchRun, run.status = finished, finished.Status
+		}(run)
+	}
+	wg.Wait()
+	fmt.Println()
+}
+
+// Runs every device of `device_matrix` in parallel instead of the single device of the step inputs, then exits
+func runDeviceMatrix(cfg Config, cfgs []Config, names []string, client *magicpod.Client, canceller *batchRunCanceller, policy *passPolicy) {
+	runs := make([]*deviceRun, len(cfgs))
+	for i := range cfgs {
+		runs[i] = &deviceRun{name: names[i], cfg: cfgs[i]}
+	}
+	log.Infof("Start batch runs on %d devices", len(runs))
+	startDeviceRuns(runs, client, canceller)
+	urls := []string{}
+	numbers := []int{}
+	for _, run := range runs {
+		if run.batchRun != nil {
+			urls = append(urls, run.batchRun.URL)
+			numbers = append(numbers, run.batchRun.BatchRunNumber)
+		} else {
+			log.Errorf("%s: %s", run.name, run.err)
+		}
+	}
+	exportOutput(outputTestURL, strings.Join(urls, "\n"))
+	exportOutput(outputBatchRunNumber, joinNumbers(numbers))
+
+	if !cfg.WaitForResult {
+		if len(urls) == 0 || (cfg.MatrixFailPolicy != "all" && len(urls) != len(runs)) {
+			failf("Failed to start batch runs")
+		}
+		log.Successf("Exit this step without waiting for the results because 'Mode' is start")
+		os.Exit(0)
+	}
+
+	log.Infof("Waiting for the test results ...")
+	waitDeviceRuns(cfg, runs, client, canceller)
+	reportDeviceRuns(cfg, runs, client, policy)
+	os.Exit(0)
+}
+
+// Decides whether the step passes by `matrix_fail_policy` from the decisions of all devices.
+// `any` fails when any device does not pass, and `all` fails only when no device passes
+func matrixDecision(policy string, runs []*deviceRun) passDecision {
+	passed := 0
+	for _, run := range runs {
+		if run.decision.passed {
+			passed++
+		}
+	}
+	reason := fmt.Sprintf("%d of %d devices passed, matrix fail policy is %s", passed, len(runs), policy)
+	if policy == "all" {
+		return passDecision{passed != 0, reason}
+	}
+	return passDecision{passed == len(runs), reason}
+}
+
+// Shows and exports the aggregated result of all devices, and fails the step by the pass policy and `matrix_fail_policy`
+func reportDeviceRuns(cfg Config, runs []*deviceRun, client *magicpod.Client, policy *passPolicy) {
+	var builder strings.Builder
+	writer := tabwriter.NewWriter(&builder, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Device\tStatus\tDecision\tSucceeded\tFailed\tUnresolved\tTotal\tURL")
+	total := magicpod.TestCases{}
+	failedNumbers := map[int]bool{}
+	unresolvedNumbers := map[int]bool{}
+	results := []map[string]interface{}{}
+	reportPaths, artifactsDirs := []string{}, []string{}
+	for _, run := range runs {
+		switch run.status {
+		case "error":
+			run.decision = passDecision{false, run.err.Error()}
+		case "timeout":
+			run.decision = passDecision{false, "batch run did not finish within max wait time"}
+		default:
+			run.decision = policy.decide(run.batchRun)
+		}
+		result := map[string]interface{}{"name": run.name, "status": run.status, "decision": run.decision.String()}
+		if run.batchRun == nil {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t-\t-\t-\t-\t%s\n", run.name, run.status, run.decision, run.err)
+			result["error"] = run.err.Error()
+			results = append(results, result)
+			continue
+		}
+		testCases := run.batchRun.TestCases
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n", run.name, run.status, run.decision,
+			testCases.Succeeded, testCases.Failed, testCases.Unresolved, testCases.Total, run.batchRun.URL)
+		total.Succeeded += testCases.Succeeded
+		total.Failed += testCases.Failed
+		total.Unresolved += testCases.Unresolved
+		total.Total += testCases.Total
+		for _, number := range run.batchRun.TestCaseNumbers("failed") {
+			failedNumbers[number] = true
+		}
+		for _, number := range run.batchRun.TestCaseNumbers("unresolved") {
+			unresolvedNumbers[number] = true
+		}
+		result["batch_run_number"] = run.batchRun.BatchRunNumber
+		result["url"] = run.batchRun.URL
+		result["test_cases"] = testCases
+		results = append(results, result)
+
+		if run.status != "timeout" && run.status != "error" {
+			reportPaths = append(reportPaths, saveTestReport(cfg, run.batchRun))
+			artifactsDirs = append(artifactsDirs, downloadArtifacts(cfg, client, run.batchRun))
+		}
+	}
+	writer.Flush()
+
+	decision := matrixDecision(cfg.MatrixFailPolicy, runs)
+	// Timeout is exported like the single device, even when the other devices are allowed to decide the result
+	status := "succeeded"
+	if !decision.passed {
+		status = "failed"
+	}
+	for _, run := range runs {
+		if run.status == "timeout" {
+			status = "timeout"
+		}
+	}
+	resultJSON, err := json.Marshal(results)
+	if err != nil {
+		failf(err.Error())
+	}
+	exportOutput(outputTestStatus, status)
+	exportTestCounts(total)
+	exportResultJSON(cfg, status, decision, runs)
+	exportOutput(outputFailedTestNumbers, joinNumbers(sortedKeys(failedNumbers)))
+	exportOutput(outputUnresolvedTestNumbers, joinNumbers(sortedKeys(unresolvedNumbers)))
+	exportOutput(outputMatrixResult, string(resultJSON))
+	exportPaths(outputJUnitXMLPath, reportPaths)
+	exportPaths(outputArtifactsDir, artifactsDirs)
+
+	for _, run := range runs {
+		if !run.decision.passed {
+			log.Warnf("%s: %s", run.name, run.decision.reason)
+		}
+	}
+	exportDecision(decision)
+	message := fmt.Sprintf("\nMagic Pod test %s on %d devices:\n%s", status, len(runs), builder.String())
+	if !decision.passed {
+		failf(message)
+	}
+	log.Successf(message)
+}
+
+func sortedKeys(set map[int]bool) []int {
+	keys := make([]int, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,63 @@
+package step
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDeviceMatrix(t *testing.T) {
+	base := Config{OsName: "iOS", DeviceType: "Simulator", Model: "iPhone 8", Version: "13.1", AppPath: "Example.app"}
+	tests := []struct {
+		name   string
+		matrix string
+	}{
+		{"YAML", `
+- name: iPhone SE
+  model: iPhone SE (3rd generation)
+  version: 16.4
+- os: Android
+  device_type: Emulator
+  model: Pixel 7
+  version: "13"
+  app_path: app.apk
+`},
+		{"JSON", `[
+	{"name": "iPhone SE", "model": "iPhone SE (3rd generation)", "version": "16.4"},
+	{"os": "Android", "device_type": "Emulator", "model": "Pixel 7", "version": "13", "app_path": "app.apk"}
+]`},
+		{"YAML flow", `[{name: iPhone SE, model: iPhone SE (3rd generation), version: 16.4},
+{os: Android, device_type: Emulator, model: Pixel 7, version: 13, app_path: app.apk}]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := base
+			cfg.DeviceMatrix = test.matrix
+			cfgs, names, err := parseDeviceMatrix(cfg)
+			if err != nil {
+				t.Fatalf("parseDeviceMatrix() error = %v", err)
+			}
+			if want := []string{"iPhone SE", "Android Pixel 7 (13)"}; !reflect.DeepEqual(names, want) {
+				t.Errorf("parseDeviceMatrix() names = %v, want %v", names, want)
+			}
+			if len(cfgs) != 2 {
+				t.Fatalf("parseDeviceMatrix() = %d configs, want 2", len(cfgs))
+			}
+			if cfg := cfgs[0]; cfg.OsName != "iOS" || cfg.Model != "iPhone SE (3rd generation)" || cfg.Version != "16.4" || cfg.AppPath != "Example.app" {
+				t.Errorf("parseDeviceMatrix()[0] = %s %s %s %s", cfg.OsName, cfg.Model, cfg.Version, cfg.AppPath)
+			}
+			if cfg := cfgs[1]; cfg.OsName != "Android" || cfg.DeviceType != "Emulator" || cfg.Version != "13" || cfg.AppPath != "app.apk" {
+				t.Errorf("parseDeviceMatrix()[1] = %s %s %s %s", cfg.OsName, cfg.DeviceType, cfg.Version, cfg.AppPath)
+			}
+		})
+	}
+}
+
+func TestParseDeviceMatrixErrors(t *testing.T) {
+	for _, matrix := range []string{"[]", "{}", "model: Pixel 7", "- model: [Pixel 7", `[{"model": "Pixel 7"`} {
+		_, _, err := parseDeviceMatrix(Config{DeviceMatrix: matrix})
+		if err == nil || !strings.HasPrefix(err.Error(), "Device matrix should ") {
+			t.Errorf("parseDeviceMatrix(%q) error = %v", matrix, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package step
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+// Converts `mode`. `wait_for_result: false` is kept working as `start` for existing workflows
+func convertModeParam(input string, waitForResult bool) (string, error) {
+	mode, err := convertChoiceParam("Mode", input, "start_and_wait", "start", "wait")
+	if err != nil {
+		return "", err
+	}
+	if mode == "start_and_wait" && !waitForResult {
+		return "start", nil
+	}
+	return mode, nil
+}
+
+// Converts comma-separated `batch_run_numbers`, which is MAGIC_POD_BATCH_RUN_NUMBER exported by `mode: start`
+func convertBatchRunNumbers(input string) ([]int, error) {
+	numbers := []int{}
+	for _, str := range strings.Split(input, ",") {
+		str = strings.TrimSpace(str)
+		if str == "" {
+			continue
+		}
+		number, err := strconv.Atoi(str)
+		if err != nil || number <= 0 {
+			return []int{}, fmt.Errorf("Batch run number %s should be a positive integer", str)
+		}
+		numbers = append(numbers, number)
+	}
+	return numbers, nil
+}
+
+// Waits for the batch runs started by another step with `mode: start`, and reports them in the same way as `start_and_wait`.
+// Multiple batch runs are reported like the device matrix, and the step fails by `matrix_fail_policy`
+func waitStartedBatchRuns(cfg Config, client *magicpod.Client, canceller *batchRunCanceller, policy *passPolicy) {
+	runs := []*deviceRun{}
+	urls := []string{}
+	for _, number := range cfg.BatchRunNumbersList {
+		run := &deviceRun{name: fmt.Sprintf("#%d", number), cfg: cfg}
+		runs = append(runs, run)
+		batchRun, err := client.GetBatchRun(number)
+		if err != nil {
+			run.status, run.err = "error", err
+			log.Errorf("Failed to get batch run #%d, error: %s", number, err)
+			continue
+		}
+		run.batchRun, run.status = batchRun, batchRun.Status
+		urls = append(urls, batchRun.URL)
+		if batchRun.Status == "running" {
+			canceller.addBatchRunNumber(number)
+		}
+		log.Printf("Batch run #%d (%s): %s", number, batchRun.Status, batchRun.URL)
+	}
+	exportOutput(outputTestURL, strings.Join(urls, "\n"))
+	fmt.Println()
+
+	if len(runs) == 1 {
+		if runs[0].batchRun == nil {
+			failf("Failed to get batch run to wait for")
+		}
+		log.Infof("Waiting for the test result ...")
+		batchRun := waitBatchRun(cfg, client, canceller, runs[0].batchRun, runs[0].startedAt)
+		reportBatchRun(cfg, client, policy, batchRun, runs[0].startedAt)
+		os.Exit(0)
+	}
+	log.Infof("Waiting for the test results ...")
+	waitDeviceRuns(cfg, runs, client, canceller)
+	reportDeviceRuns(cfg, runs, client, policy)
+	os.Exit(0)
+}
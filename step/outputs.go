@@ -0,0 +1,26 @@
+package step
+
+// Environment variables exported by this step. They should be exactly the same as `outputs` in step.yml,
+// which is checked by TestOutputsAreDeclaredInStepYML
+const (
+	outputTestStatus            = "MAGIC_POD_TEST_STATUS"
+	outputTestSucceededCount    = "MAGIC_POD_TEST_SUCCEEDED_COUNT"
+	outputTestPassedCount       = "MAGIC_POD_TEST_PASSED_COUNT" // same as outputTestSucceededCount, kept because step.yml declared it
+	outputTestFailedCount       = "MAGIC_POD_TEST_FAILED_COUNT"
+	outputTestUnresolvedCount   = "MAGIC_POD_TEST_UNRESOLVED_COUNT"
+	outputTestTotalCount        = "MAGIC_POD_TEST_TOTAL_COUNT"
+	outputTestDecision          = "MAGIC_POD_TEST_DECISION"
+	outputTestDecisionReason    = "MAGIC_POD_TEST_DECISION_REASON"
+	outputTestURL               = "MAGIC_POD_TEST_URL"
+	outputRerunTestURL          = "MAGIC_POD_RERUN_TEST_URL"
+	outputBatchRunNumber        = "MAGIC_POD_BATCH_RUN_NUMBER"
+	outputTestResultJSON        = "MAGIC_POD_TEST_RESULT_JSON"
+	outputJUnitXMLPath          = "MAGIC_POD_JUNIT_XML_PATH"
+	outputFailedTestNumbers     = "MAGIC_POD_FAILED_TEST_NUMBERS"
+	outputUnresolvedTestNumbers = "MAGIC_POD_UNRESOLVED_TEST_NUMBERS"
+	outputArtifactsDir          = "MAGIC_POD_ARTIFACTS_DIR"
+	outputMatrixResult          = "MAGIC_POD_MATRIX_RESULT"
+	outputBundleID              = "MAGIC_POD_BUNDLE_ID"
+	outputAppPackage            = "MAGIC_POD_APP_PACKAGE"
+	outputAppActivity           = "MAGIC_POD_APP_ACTIVITY"
+)
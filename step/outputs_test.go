@@ -0,0 +1,101 @@
+package step
+
+import (
+	"bufio"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Names of the outputs declared in step.yml
+func declaredOutputs(t *testing.T) []string {
+	file, err := os.Open("../step.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	pattern := regexp.MustCompile(`^  - ([A-Z0-9_]+):`)
+	names := []string{}
+	inOutputs := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "#") && line != "" {
+			inOutputs = line == "outputs:"
+			continue
+		}
+		if match := pattern.FindStringSubmatch(line); inOutputs && match != nil {
+			names = append(names, match[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestOutputsAreDeclaredInStepYML(t *testing.T) {
+	fset := token.NewFileSet()
+	packages, err := parser.ParseDir(fset, ".", func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Constants in outputs.go, and the ones passed to exportOutput
+	constants := map[string]string{}
+	exported := map[string]bool{}
+	for name, file := range packages["step"].Files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.ValueSpec:
+				if !strings.HasSuffix(name, "outputs.go") {
+					return true
+				}
+				for i, ident := range node.Names {
+					if literal, ok := node.Values[i].(*ast.BasicLit); ok {
+						value, _ := strconv.Unquote(literal.Value)
+						constants[ident.Name] = value
+					}
+				}
+			case *ast.CallExpr:
+				if len(node.Args) == 0 {
+					return true
+				}
+				switch literal := node.Args[0].(type) {
+				case *ast.Ident:
+					if function, ok := node.Fun.(*ast.Ident); ok && (function.Name == "exportOutput" || function.Name == "exportPaths") {
+						exported[literal.Name] = true
+					}
+				case *ast.BasicLit:
+					if strings.HasPrefix(literal.Value, `"MAGIC_POD_`) {
+						t.Errorf("%s: %s should be exported by exportOutput with the constant in outputs.go",
+							fset.Position(literal.Pos()), literal.Value)
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	values := []string{}
+	for constant, value := range constants {
+		if !exported[constant] {
+			t.Errorf("%s in outputs.go is never exported", constant)
+		}
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	if declared := declaredOutputs(t); !reflect.DeepEqual(values, declared) {
+		t.Errorf("outputs.go has %v, but step.yml declares %v", values, declared)
+	}
+}
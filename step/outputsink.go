@@ -0,0 +1,200 @@
+package step
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-tools/go-steputils/tools"
+)
+
+// File written by `gitlab` sink, which should be declared as `artifacts:reports:dotenv` of the job
+const gitlabDotenvFileName = "magicpod.env"
+
+// File which the outputs are written to when `auto` detects no CI service, so that they are not lost
+const fallbackOutputFileName = "magicpod-outputs.env"
+
+// Destination of the outputs of this step, so that the following steps of the CI service can use them
+type outputSink interface {
+	export(key, value string) error
+	// Markdown summary of the result shown on the CI service. Sinks which cannot show it ignore it
+	summary(markdown string) error
+}
+
+// Sinks used by exportOutput. Bitrise is the default until useOutputSinks is called
+var outputSinks = []outputSink{envmanSink{}}
+
+// Converts comma-separated `output_sinks`. `auto` is resolved into the sinks of the CI service detected from the environment
+func convertOutputSinksParam(input, outputFile string) (string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" || input == "auto" {
+		sinks := []string{}
+		if os.Getenv("ENVMAN_ENVSTORE_PATH") != "" {
+			sinks = append(sinks, "envman")
+		}
+		if os.Getenv("GITHUB_ACTIONS") == "true" {
+			sinks = append(sinks, "github")
+		}
+		if os.Getenv("GITLAB_CI") == "true" {
+			sinks = append(sinks, "gitlab")
+		}
+		if outputFile != "" {
+			sinks = append(sinks, "file")
+		}
+		return strings.Join(sinks, ","), nil
+	}
+
+	sinks := []string{}
+	for _, sink := range strings.Split(input, ",") {
+		sink = strings.TrimSpace(sink)
+		switch sink {
+		case "envman", "github", "gitlab":
+		case "file":
+			if outputFile == "" {
+				return "", fmt.Errorf("Output file is required when Output sinks has 'file'")
+			}
+		default:
+			return "", fmt.Errorf("Output sinks should be 'auto' or comma-separated 'envman', 'github', 'gitlab' and 'file'")
+		}
+		sinks = append(sinks, sink)
+	}
+	return strings.Join(sinks, ","), nil
+}
+
+// Replaces the sinks by the converted `output_sinks`
+func useOutputSinks(cfg Config) {
+	if cfg.OutputSinks == "" {
+		log.Warnf("No CI service is detected, so the outputs are written to %s. Set Output sinks to change it", fallbackOutputFileName)
+		outputSinks = []outputSink{dotenvSink{path: fallbackOutputFileName, quote: true}}
+		return
+	}
+	outputSinks = []outputSink{}
+	for _, sink := range strings.Split(cfg.OutputSinks, ",") {
+		switch sink {
+		case "envman":
+			outputSinks = append(outputSinks, envmanSink{})
+		case "github":
+			outputSinks = append(outputSinks, githubSink{
+				outputPath:  os.Getenv("GITHUB_OUTPUT"),
+				envPath:     os.Getenv("GITHUB_ENV"),
+				summaryPath: os.Getenv("GITHUB_STEP_SUMMARY"),
+			})
+		case "gitlab":
+			outputSinks = append(outputSinks, dotenvSink{path: gitlabDotenvFileName, quote: false})
+		case "file":
+			outputSinks = append(outputSinks, dotenvSink{path: cfg.OutputFile, quote: true})
+		}
+	}
+}
+
+// Exports the output to all the sinks
+func exportOutput(key, value string) {
+	for _, sink := range outputSinks {
+		if err := sink.export(key, value); err != nil {
+			log.Warnf("Failed to export %s, error: %s", key, err)
+		}
+	}
+}
+
+// Exports the environment variable only when the outputs go to envman, e.g. BITRISE_CACHE_INCLUDE_PATHS
+// which means nothing outside of Bitrise
+func exportEnvmanOnly(key, value string) error {
+	for _, sink := range outputSinks {
+		if _, ok := sink.(envmanSink); ok {
+			return sink.export(key, value)
+		}
+	}
+	return nil
+}
+
+func exportSummary(markdown string) {
+	for _, sink := range outputSinks {
+		if err := sink.summary(markdown); err != nil {
+			log.Warnf("Failed to write the summary, error: %s", err)
+		}
+	}
+}
+
+// Environment variables of the following steps of Bitrise
+type envmanSink struct{}
+
+func (envmanSink) export(key, value string) error {
+	return tools.ExportEnvironmentWithEnvman(key, value)
+}
+
+func (envmanSink) summary(markdown string) error {
+	return nil
+}
+
+// Step outputs, environment variables of the following steps and the job summary of GitHub Actions.
+// Empty paths are skipped, e.g. GITHUB_STEP_SUMMARY is not available on old GitHub Enterprise Server
+type githubSink struct {
+	outputPath  string
+	envPath     string
+	summaryPath string
+}
+
+func (sink githubSink) export(key, value string) error {
+	delimiter, err := randomDelimiter()
+	if err != nil {
+		return err
+	}
+	// The heredoc format works for both single-line and multiline values
+	entry := fmt.Sprintf("%s<<%s\n%s\n%s\n", key, delimiter, value, delimiter)
+	for _, path := range []string{sink.outputPath, sink.envPath} {
+		if err := appendToFile(path, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sink githubSink) summary(markdown string) error {
+	return appendToFile(sink.summaryPath, markdown+"\n")
+}
+
+// KEY=VALUE file. Quoted values can be read by `source` of shells, and unquoted ones are for GitLab dotenv reports,
+// which do not support multiline values so that newlines are replaced with spaces
+type dotenvSink struct {
+	path  string
+	quote bool
+}
+
+func (sink dotenvSink) export(key, value string) error {
+	if sink.quote {
+		value = "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+	} else {
+		value = strings.Replace(strings.Replace(value, "\r\n", " ", -1), "\n", " ", -1)
+	}
+	return appendToFile(sink.path, key+"="+value+"\n")
+}
+
+func (dotenvSink) summary(markdown string) error {
+	return nil
+}
+
+func randomDelimiter() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return "MAGIC_POD_EOF_" + hex.EncodeToString(bytes), nil
+}
+
+func appendToFile(path, content string) error {
+	if path == "" {
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
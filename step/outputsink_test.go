@@ -0,0 +1,36 @@
+package step
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestOutputSinksFallBackToFile(t *testing.T) {
+	for _, key := range []string{"ENVMAN_ENVSTORE_PATH", "GITHUB_ACTIONS", "GITLAB_CI"} {
+		t.Setenv(key, "")
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(dir)
+	defer func(sinks []outputSink) { outputSinks = sinks }(outputSinks)
+
+	sinks, err := convertOutputSinksParam("auto", "")
+	if err != nil || sinks != "" {
+		t.Fatalf("convertOutputSinksParam() = %q, %v, want no sink", sinks, err)
+	}
+	useOutputSinks(Config{OutputSinks: sinks})
+	exportOutput(outputTestStatus, "succeeded")
+	data, err := ioutil.ReadFile(fallbackOutputFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "MAGIC_POD_TEST_STATUS='succeeded'\n"; string(data) != want {
+		t.Errorf("%s = %q, want %q", fallbackOutputFileName, data, want)
+	}
+}
@@ -0,0 +1,173 @@
+package step
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+// Decides whether the finished batch run passes the step, by `allowed_failures`, `unresolved_policy`,
+// `quarantined_test_numbers` and `critical_test_numbers`. By default only `succeeded` passes
+type passPolicy struct {
+	allowedFailures       int
+	allowedFailurePercent float64 // used instead of allowedFailures when it is not negative
+	unresolvedPasses      bool
+	quarantined           map[int]bool
+	critical              map[int]bool
+}
+
+// Decision of passPolicy with the reason shown to users
+type passDecision struct {
+	passed bool
+	reason string
+}
+
+func (decision passDecision) String() string {
+	if decision.passed {
+		return "passed"
+	}
+	return "failed"
+}
+
+func newPassPolicy(cfg Config) (*passPolicy, []error) {
+	errors := []error{}
+	policy := &passPolicy{allowedFailurePercent: -1, quarantined: map[int]bool{}, critical: map[int]bool{}}
+
+	allowed := strings.TrimSpace(cfg.AllowedFailures)
+	if strings.HasSuffix(allowed, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(allowed, "%")), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			errors = append(errors, fmt.Errorf("Allowed failures %s should be a percentage between 0%% and 100%%", allowed))
+		}
+		policy.allowedFailurePercent = percent
+	} else if allowed != "" {
+		count, err := strconv.Atoi(allowed)
+		if err != nil || count < 0 {
+			errors = append(errors, fmt.Errorf("Allowed failures %s should be a number or a percentage like 10%%", allowed))
+		}
+		policy.allowedFailures = count
+	}
+
+	unresolvedPolicy, err := convertChoiceParam("Unresolved policy", cfg.UnresolvedPolicy, "fail", "pass")
+	if err != nil {
+		errors = append(errors, err)
+	}
+	policy.unresolvedPasses = unresolvedPolicy == "pass"
+
+	numberLists := []struct {
+		title string
+		input string
+		set   map[int]bool
+	}{
+		{"Quarantined test case numbers", cfg.QuarantinedTestNumbers, policy.quarantined},
+		{"Critical test case numbers", cfg.CriticalTestNumbers, policy.critical},
+	}
+	for _, list := range numberLists {
+		numbers, err := convertTestCaseNumber(list.input)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("%s: %s", list.title, err))
+		}
+		for _, number := range numbers {
+			list.set[number] = true
+		}
+	}
+	for number := range policy.critical {
+		if policy.quarantined[number] {
+			errors = append(errors, fmt.Errorf("Test case #%d cannot be both quarantined and critical", number))
+		}
+	}
+	return policy, errors
+}
+
+func (policy *passPolicy) decide(batchRun *magicpod.BatchRun) passDecision {
+	switch batchRun.Status {
+	case "succeeded":
+		return passDecision{true, "all test cases succeeded"}
+	case "failed", "unresolved":
+		// Decided by the results of the test cases below
+	default:
+		return passDecision{false, fmt.Sprintf("batch run is %s", batchRun.Status)}
+	}
+
+	testCases := batchRun.TestCases
+	failures := 0
+	considered := 0
+	forgiven := 0 // failed or unresolved test cases which are not counted as failures
+	ignored := []int{}
+	if len(testCases.Details) == 0 {
+		// Results of each test case are not available, so quarantined and critical test cases cannot be told
+		failures = testCases.Failed
+		if policy.unresolvedPasses {
+			forgiven = testCases.Unresolved
+		} else {
+			failures += testCases.Unresolved
+		}
+		considered = testCases.Total
+		// Failing by the counts is safer than passing a failed critical test case within the allowed failures
+		if failures > 0 && (len(policy.quarantined) != 0 || len(policy.critical) != 0) {
+			return passDecision{false, fmt.Sprintf("%d test cases failed, and they cannot be checked against "+
+				"the quarantined and critical test cases because the result of each test case is not available", failures)}
+		}
+	}
+	for _, result := range testCases.Details {
+		failing := result.Status == "failed" || (result.Status == "unresolved" && !policy.unresolvedPasses)
+		if policy.quarantined[result.Number] {
+			if result.Status == "failed" || result.Status == "unresolved" {
+				forgiven++
+			}
+			if failing {
+				ignored = append(ignored, result.Number)
+			}
+			continue
+		}
+		considered++
+		if result.Status == "unresolved" && policy.unresolvedPasses {
+			forgiven++
+		}
+		if !failing {
+			continue
+		}
+		if policy.critical[result.Number] {
+			return passDecision{false, fmt.Sprintf("critical test case #%d is %s", result.Number, result.Status)}
+		}
+		failures++
+	}
+	decision := policy.decideByCount(failures, considered, ignored)
+	// Magic Pod decided that the batch run did not succeed, so it passes only when the policy forgave
+	// some test cases, by the threshold, quarantine or `unresolved_policy`
+	if decision.passed && failures == 0 && forgiven == 0 {
+		return passDecision{false, fmt.Sprintf("batch run is %s, but no failed or unresolved test case is found", batchRun.Status)}
+	}
+	return decision
+}
+
+func (policy *passPolicy) decideByCount(failures, total int, ignored []int) passDecision {
+	var decision passDecision
+	switch {
+	case failures == 0:
+		decision = passDecision{true, "no test case failed"}
+	case policy.allowedFailurePercent >= 0:
+		percent := 100 * float64(failures) / float64(total)
+		decision = passDecision{percent <= policy.allowedFailurePercent,
+			fmt.Sprintf("%d of %d test cases (%.1f%%) failed, %g%% allowed", failures, total, percent, policy.allowedFailurePercent)}
+	default:
+		decision = passDecision{failures <= policy.allowedFailures,
+			fmt.Sprintf("%d of %d test cases failed, %d allowed", failures, total, policy.allowedFailures)}
+	}
+	if policy.unresolvedPasses {
+		decision.reason += ", unresolved ones are not counted"
+	}
+	if len(ignored) != 0 {
+		decision.reason += fmt.Sprintf(", quarantined test cases %s are ignored", joinNumbers(ignored))
+	}
+	return decision
+}
+
+func exportDecision(decision passDecision) {
+	log.Infof("Decision: %s (%s)", decision, decision.reason)
+	exportOutput(outputTestDecision, decision.String())
+	exportOutput(outputTestDecisionReason, decision.reason)
+}
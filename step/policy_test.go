@@ -0,0 +1,84 @@
+package step
+
+import (
+	"testing"
+
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+func TestPassPolicyDecide(t *testing.T) {
+	details := func(statuses ...string) []magicpod.TestCaseResult {
+		results := []magicpod.TestCaseResult{}
+		for i, status := range statuses {
+			results = append(results, magicpod.TestCaseResult{Number: i + 1, Status: status})
+		}
+		return results
+	}
+	tests := []struct {
+		name     string
+		cfg      Config
+		batchRun magicpod.BatchRun
+		passed   bool
+	}{
+		{"succeeded", Config{}, magicpod.BatchRun{Status: "succeeded"}, true},
+		{"failed without counts", Config{}, magicpod.BatchRun{Status: "failed"}, false},
+		{"failed with only succeeded details", Config{},
+			magicpod.BatchRun{Status: "failed", TestCases: magicpod.TestCases{Details: details("succeeded", "succeeded")}}, false},
+		{"failed by count", Config{},
+			magicpod.BatchRun{Status: "failed", TestCases: magicpod.TestCases{Succeeded: 1, Failed: 1, Total: 2}}, false},
+		{"failed within allowed failures", Config{AllowedFailures: "1"},
+			magicpod.BatchRun{Status: "failed", TestCases: magicpod.TestCases{Details: details("succeeded", "failed")}}, true},
+		{"failed over allowed percentage", Config{AllowedFailures: "40%"},
+			magicpod.BatchRun{Status: "failed", TestCases: magicpod.TestCases{Details: details("succeeded", "failed")}}, false},
+		{"failed only by quarantined", Config{QuarantinedTestNumbers: "2"},
+			magicpod.BatchRun{Status: "failed", TestCases: magicpod.TestCases{Details: details("succeeded", "failed")}}, true},
+		{"failed by critical within allowed failures", Config{AllowedFailures: "5", CriticalTestNumbers: "2"},
+			magicpod.BatchRun{Status: "failed", TestCases: magicpod.TestCases{Details: details("succeeded", "failed")}}, false},
+		{"failed counts within allowed failures with critical", Config{AllowedFailures: "5", CriticalTestNumbers: "2"},
+			magicpod.BatchRun{Status: "failed", TestCases: magicpod.TestCases{Succeeded: 1, Failed: 1, Total: 2}}, false},
+		{"failed counts with quarantined", Config{QuarantinedTestNumbers: "2"},
+			magicpod.BatchRun{Status: "failed", TestCases: magicpod.TestCases{Succeeded: 1, Failed: 1, Total: 2}}, false},
+		{"unresolved counts with critical and unresolved policy pass", Config{UnresolvedPolicy: "pass", CriticalTestNumbers: "2"},
+			magicpod.BatchRun{Status: "unresolved", TestCases: magicpod.TestCases{Succeeded: 1, Unresolved: 1, Total: 2}}, true},
+		{"unresolved by default", Config{},
+			magicpod.BatchRun{Status: "unresolved", TestCases: magicpod.TestCases{Details: details("succeeded", "unresolved")}}, false},
+		{"unresolved with unresolved policy pass", Config{UnresolvedPolicy: "pass"},
+			magicpod.BatchRun{Status: "unresolved", TestCases: magicpod.TestCases{Details: details("succeeded", "unresolved")}}, true},
+		{"unresolved counts with unresolved policy pass", Config{UnresolvedPolicy: "pass"},
+			magicpod.BatchRun{Status: "unresolved", TestCases: magicpod.TestCases{Succeeded: 1, Unresolved: 1, Total: 2}}, true},
+		{"unresolved only by quarantined", Config{QuarantinedTestNumbers: "2"},
+			magicpod.BatchRun{Status: "unresolved", TestCases: magicpod.TestCases{Details: details("succeeded", "unresolved")}}, true},
+		{"unresolved policy pass does not forgive failed", Config{UnresolvedPolicy: "pass"},
+			magicpod.BatchRun{Status: "failed", TestCases: magicpod.TestCases{Details: details("failed", "unresolved")}}, false},
+		{"aborted", Config{AllowedFailures: "100%"}, magicpod.BatchRun{Status: "aborted"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, errors := newPassPolicy(test.cfg)
+			if len(errors) != 0 {
+				t.Fatalf("newPassPolicy() errors = %v", errors)
+			}
+			decision := policy.decide(&test.batchRun)
+			if decision.passed != test.passed {
+				t.Errorf("decide() = %s (%s), want passed = %v", decision, decision.reason, test.passed)
+			}
+		})
+	}
+}
+
+// A rerun which leaves only unresolved test cases is decided by `unresolved_policy`
+func TestPassPolicyDecideRerunLeavingUnresolved(t *testing.T) {
+	original := &magicpod.BatchRun{Status: "failed", TestCases: magicpod.TestCases{Details: []magicpod.TestCaseResult{
+		{Number: 1, Status: "failed"}, {Number: 2, Status: "unresolved"},
+	}}}
+	rerun := &magicpod.BatchRun{Status: "unresolved", TestCases: magicpod.TestCases{Details: []magicpod.TestCaseResult{
+		{Number: 1, Status: "succeeded"}, {Number: 2, Status: "unresolved"},
+	}}}
+	merged := magicpod.MergeRerun(original, rerun)
+	for unresolvedPolicy, passed := range map[string]bool{"fail": false, "pass": true} {
+		policy, _ := newPassPolicy(Config{UnresolvedPolicy: unresolvedPolicy})
+		if decision := policy.decide(merged); decision.passed != passed {
+			t.Errorf("unresolved_policy=%s: decide() = %s (%s), want passed = %v", unresolvedPolicy, decision, decision.reason, passed)
+		}
+	}
+}
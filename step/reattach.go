@@ -0,0 +1,152 @@
+package step
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+const startedBatchRunsFileName = "magicpod-started-batch-runs.json"
+
+// Batch run started by this step, remembered to reattach to it when the step or the build runs again
+type startedBatchRun struct {
+	BatchRunNumber int       `json:"batch_run_number"`
+	AppFileNumber  int       `json:"app_file_number"`
+	StartedAt      time.Time `json:"started_at"`
+}
+
+// State file in `reattach_state_dir`, which is shared with the restarted build by Cache:Push step.
+// Entries are keyed by the build and the hash of the parameters to start the batch run and the app contents
+type startedBatchRuns struct {
+	Entries map[string]startedBatchRun `json:"entries"`
+}
+
+// Entries older than this are neither reattached nor kept, so that the state file does not grow forever
+const startedBatchRunMaxAge = 7 * 24 * time.Hour
+
+// Device matrix starts batch runs concurrently
+var startedBatchRunsMutex sync.Mutex
+
+// The temporary directory is used when `reattach_state_dir` is empty, which only survives retries in the same build
+func startedBatchRunsPath(cfg Config) string {
+	dir := cfg.ReattachStateDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, startedBatchRunsFileName)
+}
+
+func loadStartedBatchRuns(path string) *startedBatchRuns {
+	state := &startedBatchRuns{Entries: map[string]startedBatchRun{}}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, state); err != nil || state.Entries == nil {
+		log.Warnf("Ignore broken state file %s", path)
+		state.Entries = map[string]startedBatchRun{}
+	}
+	for key, entry := range state.Entries {
+		if time.Since(entry.StartedAt) > startedBatchRunMaxAge {
+			delete(state.Entries, key)
+		}
+	}
+	return state
+}
+
+// Returns empty when reattaching is disabled, or outside of Bitrise builds.
+// A restarted build has another BITRISE_BUILD_SLUG, so the build is identified by the workflow and the commit.
+// BITRISE_BUILD_SLUG is used only when the commit is unknown, and then only retries in the same build are covered
+func startedBatchRunKey(cfg Config) string {
+	build := os.Getenv("BITRISE_BUILD_SLUG")
+	if !cfg.ReattachBatchRun || build == "" {
+		return ""
+	}
+	if commit := os.Getenv("BITRISE_GIT_COMMIT"); commit != "" {
+		build = os.Getenv("BITRISE_TRIGGERED_WORKFLOW_ID") + "@" + commit
+	}
+	// Inputs which do not change the batch run itself, such as waiting options, are not part of the key
+	params := createStartBatchRunParams(cfg, -1)
+	delete(params, "app_file_number")
+	// The file number changes every upload, so the app is identified by its contents hashed by hashApp instead.
+	// Otherwise the rebuilt app would be reattached to the batch run of the old one
+	if cfg.AppType == "app_file" {
+		if cfg.AppContentHash == "" {
+			return ""
+		}
+		params["app_hash"] = cfg.AppContentHash
+	}
+	params["base_url"], params["organization_name"], params["project_name"] = cfg.BaseURL, cfg.OrganizationName, cfg.ProjectName
+	data, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(data)
+	return build + ":" + hex.EncodeToString(hash[:])
+}
+
+// Finds the batch run started with the same configuration by the previous attempt of this step or the build.
+// Aborted batch runs and the ones which cannot be read are not reattached, so that a new batch run is started
+func findStartedBatchRun(cfg Config, client *magicpod.Client) (*magicpod.BatchRun, *startedBatchRun) {
+	key := startedBatchRunKey(cfg)
+	if key == "" {
+		return nil, nil
+	}
+	startedBatchRunsMutex.Lock()
+	entry, ok := loadStartedBatchRuns(startedBatchRunsPath(cfg)).Entries[key]
+	startedBatchRunsMutex.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	batchRun, err := client.GetBatchRun(entry.BatchRunNumber)
+	if err != nil {
+		log.Warnf("Batch run #%d started by the previous attempt cannot be read, so start a new one. error: %s", entry.BatchRunNumber, err)
+		return nil, nil
+	}
+	if batchRun.Status == "aborted" {
+		log.Printf("Batch run #%d started by the previous attempt was aborted, so start a new one", entry.BatchRunNumber)
+		return nil, nil
+	}
+	return batchRun, &entry
+}
+
+func rememberStartedBatchRun(cfg Config, batchRun *magicpod.BatchRun, appFileNumber int, startedAt time.Time) {
+	key := startedBatchRunKey(cfg)
+	if key == "" {
+		return
+	}
+	startedBatchRunsMutex.Lock()
+	defer startedBatchRunsMutex.Unlock()
+	path := startedBatchRunsPath(cfg)
+	state := loadStartedBatchRuns(path)
+	state.Entries[key] = startedBatchRun{batchRun.BatchRunNumber, appFileNumber, startedAt}
+	if err := saveStartedBatchRuns(cfg, path, state); err != nil {
+		log.Warnf("Failed to save batch run #%d to the state file, so it will not be reattached on retry. error: %s",
+			batchRun.BatchRunNumber, err)
+	}
+}
+
+func saveStartedBatchRuns(cfg Config, path string, state *startedBatchRuns) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	if cfg.ReattachStateDir == "" {
+		return nil
+	}
+	return addCacheIncludePath(path)
+}
@@ -0,0 +1,97 @@
+package step
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartedBatchRunKeyChangesWithApp(t *testing.T) {
+	t.Setenv("BITRISE_BUILD_SLUG", "build")
+	dir := t.TempDir()
+	appPath := filepath.Join(dir, "Example.app")
+	if err := os.Mkdir(appPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeApp := func(content string) {
+		if err := ioutil.WriteFile(filepath.Join(appPath, "Example"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := Config{ReattachBatchRun: true, OsName: "ios", DeviceType: "simulator", AppType: "app_file", AppPath: appPath}
+	// Every run of the step hashes the app by itself
+	keyOf := func(cfg Config) string {
+		cfg.hashApp()
+		return startedBatchRunKey(cfg)
+	}
+
+	writeApp("build 1")
+	key := keyOf(cfg)
+	if key == "" {
+		t.Fatal("startedBatchRunKey() is empty")
+	}
+	writeApp("build 1")
+	if again := keyOf(cfg); again != key {
+		t.Errorf("startedBatchRunKey() = %s for the same app, want %s", again, key)
+	}
+	writeApp("build 2")
+	if rebuilt := keyOf(cfg); rebuilt == key {
+		t.Errorf("startedBatchRunKey() = %s for the rebuilt app, want another key", rebuilt)
+	}
+	missing := cfg
+	missing.AppPath = filepath.Join(dir, "Missing.app")
+	if key := keyOf(missing); key != "" {
+		t.Errorf("startedBatchRunKey() = %s for the missing app, want empty", key)
+	}
+
+	cfg.AppType = "app_url"
+	if key := startedBatchRunKey(cfg); key == "" {
+		t.Error("startedBatchRunKey() is empty for app_url")
+	}
+	cfg.ReattachBatchRun = false
+	if key := startedBatchRunKey(cfg); key != "" {
+		t.Errorf("startedBatchRunKey() = %s, want empty when reattaching is disabled", key)
+	}
+}
+
+func TestStartedBatchRunKeySurvivesRestart(t *testing.T) {
+	t.Setenv("BITRISE_TRIGGERED_WORKFLOW_ID", "test")
+	t.Setenv("BITRISE_GIT_COMMIT", "abc123")
+	cfg := Config{ReattachBatchRun: true, OsName: "ios", DeviceType: "simulator", AppType: "app_url"}
+
+	t.Setenv("BITRISE_BUILD_SLUG", "build")
+	key := startedBatchRunKey(cfg)
+	t.Setenv("BITRISE_BUILD_SLUG", "restarted")
+	if restarted := startedBatchRunKey(cfg); restarted != key {
+		t.Errorf("startedBatchRunKey() = %s in the restarted build, want %s", restarted, key)
+	}
+	t.Setenv("BITRISE_GIT_COMMIT", "def456")
+	if other := startedBatchRunKey(cfg); other == key {
+		t.Errorf("startedBatchRunKey() = %s for another commit, want another key", other)
+	}
+}
+
+func TestStartedBatchRunsState(t *testing.T) {
+	t.Setenv("BITRISE_CACHE_INCLUDE_PATHS", "")
+	defer func(sinks []outputSink) { outputSinks = sinks }(outputSinks)
+	outputSinks = []outputSink{}
+	cfg := Config{ReattachStateDir: filepath.Join(t.TempDir(), "cache")}
+	path := startedBatchRunsPath(cfg)
+	state := &startedBatchRuns{Entries: map[string]startedBatchRun{
+		"recent": {BatchRunNumber: 2, StartedAt: time.Now().Add(-time.Hour)},
+		"old":    {BatchRunNumber: 1, StartedAt: time.Now().Add(-startedBatchRunMaxAge - time.Hour)},
+	}}
+	if err := saveStartedBatchRuns(cfg, path, state); err != nil {
+		t.Fatalf("saveStartedBatchRuns() error = %v", err)
+	}
+	if includePaths := os.Getenv("BITRISE_CACHE_INCLUDE_PATHS"); !strings.Contains(includePaths, path) {
+		t.Errorf("BITRISE_CACHE_INCLUDE_PATHS = %q, want to include %s", includePaths, path)
+	}
+	loaded := loadStartedBatchRuns(path)
+	if _, ok := loaded.Entries["old"]; ok || loaded.Entries["recent"].BatchRunNumber != 2 {
+		t.Errorf("loadStartedBatchRuns() = %v, want only the recent entry", loaded.Entries)
+	}
+}
@@ -0,0 +1,102 @@
+package step
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+// How many recent batch runs are searched for `rerun_failed_from: latest`
+const latestBatchRunSearchCount = 20
+
+// Validates `rerun_failed_from`, which is either of a batch run number or `latest`
+func convertRerunFailedFromParam(input string) (string, error) {
+	if input == "" || input == "latest" {
+		return input, nil
+	}
+	if number, err := strconv.Atoi(input); err != nil || number <= 0 {
+		return "", fmt.Errorf("Rerun failed from %s should be a batch run number or 'latest'", input)
+	}
+	return input, nil
+}
+
+// Numbers of failed and unresolved test cases of the batch run specified by `rerun_failed_from`
+func rerunTestCaseNumbers(cfg Config, client *magicpod.Client) ([]int, *magicpod.BatchRun, error) {
+	var batchRunNumber int
+	if cfg.RerunFailedFrom == "latest" {
+		batchRuns, err := client.ListBatchRuns(latestBatchRunSearchCount)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, batchRun := range batchRuns {
+			if batchRun.Status != "running" {
+				batchRunNumber = batchRun.BatchRunNumber
+				break
+			}
+		}
+		if batchRunNumber == 0 {
+			return nil, nil, fmt.Errorf("no finished batch run is found in the latest %d batch runs", latestBatchRunSearchCount)
+		}
+	} else {
+		batchRunNumber, _ = strconv.Atoi(cfg.RerunFailedFrom)
+	}
+
+	batchRun, err := client.GetBatchRun(batchRunNumber)
+	if err != nil {
+		return nil, nil, err
+	}
+	if batchRun.Status == "running" {
+		return nil, nil, fmt.Errorf("batch run #%d is still running", batchRunNumber)
+	}
+	numbers := failedTestCaseNumbers(batchRun)
+	if len(numbers) == 0 && batchRun.TestCases.Failed+batchRun.TestCases.Unresolved != 0 {
+		return nil, nil, fmt.Errorf("results of each test case are not available for batch run #%d", batchRunNumber)
+	}
+	return numbers, batchRun, nil
+}
+
+func failedTestCaseNumbers(batchRun *magicpod.BatchRun) []int {
+	numbers := append(batchRun.TestCaseNumbers("failed"), batchRun.TestCaseNumbers("unresolved")...)
+	sort.Ints(numbers)
+	return numbers
+}
+
+// Reruns the failed and unresolved test cases of the finished batch run once, and returns the merged result.
+// The original result is returned as it is when the rerun cannot be started
+func rerunFailedTestCases(cfg Config, client *magicpod.Client, canceller *batchRunCanceller, appFileNumber int, batchRun *magicpod.BatchRun) *magicpod.BatchRun {
+	numbers := failedTestCaseNumbers(batchRun)
+	if len(numbers) == 0 {
+		return batchRun
+	}
+	log.Infof("Rerun %d failed and unresolved test cases: %s", len(numbers), joinNumbers(numbers))
+	rerunCfg := cfg
+	rerunCfg.TestCaseNumbersList = numbers
+	rerun, started := findStartedBatchRun(rerunCfg, client)
+	startedAt := time.Now()
+	if rerun != nil {
+		startedAt = started.StartedAt
+		log.Donef("Reattached to rerun batch run #%d (%s) started by the previous attempt of this step. You can check detail progress on %s\n",
+			rerun.BatchRunNumber, rerun.Status, rerun.URL)
+	} else {
+		var err error
+		rerun, err = startBatchRun(rerunCfg, client, appFileNumber)
+		if err != nil {
+			log.Warnf("Failed to start rerun, error: %s", err)
+			return batchRun
+		}
+		log.Donef("Batch run #%d has started. You can check detail progress on %s\n", rerun.BatchRunNumber, rerun.URL)
+	}
+	canceller.addBatchRunNumber(rerun.BatchRunNumber)
+	exportOutput(outputRerunTestURL, rerun.URL)
+
+	log.Infof("Waiting for the rerun result ...")
+	rerun = waitBatchRun(cfg, client, canceller, rerun, startedAt)
+	merged := magicpod.MergeRerun(batchRun, rerun)
+	log.Infof("Rerun finished as %s: %d of %d test cases succeeded. Results of batch run #%d are merged into #%d",
+		rerun.Status, rerun.TestCases.Succeeded, len(numbers), rerun.BatchRunNumber, batchRun.BatchRunNumber)
+	return merged
+}
@@ -0,0 +1,79 @@
+package step
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+// Joins numbers by comma, which is the format of `test_case_numbers` and `batch_run_numbers` inputs
+func joinNumbers(numbers []int) string {
+	strList := make([]string, len(numbers))
+	for i, number := range numbers {
+		strList[i] = strconv.Itoa(number)
+	}
+	return strings.Join(strList, ",")
+}
+
+// Exports the paths written for the batch runs, one per line, so that the device matrix exports all of them.
+// Nothing is exported when no path is written
+func exportPaths(key string, paths []string) {
+	written := []string{}
+	for _, path := range paths {
+		if path != "" {
+			written = append(written, path)
+		}
+	}
+	if len(written) != 0 {
+		exportOutput(key, strings.Join(written, "\n"))
+	}
+}
+
+// Exports the counts of test cases. MAGIC_POD_TEST_PASSED_COUNT has the same value as MAGIC_POD_TEST_SUCCEEDED_COUNT
+func exportTestCounts(testCases magicpod.TestCases) {
+	exportOutput(outputTestSucceededCount, strconv.Itoa(testCases.Succeeded))
+	exportOutput(outputTestPassedCount, strconv.Itoa(testCases.Succeeded))
+	exportOutput(outputTestFailedCount, strconv.Itoa(testCases.Failed))
+	exportOutput(outputTestUnresolvedCount, strconv.Itoa(testCases.Unresolved))
+	exportOutput(outputTestTotalCount, strconv.Itoa(testCases.Total))
+}
+
+func exportFailedTestCaseNumbers(batchRun *magicpod.BatchRun) {
+	exportOutput(outputFailedTestNumbers, joinNumbers(batchRun.TestCaseNumbers("failed")))
+	exportOutput(outputUnresolvedTestNumbers, joinNumbers(batchRun.TestCaseNumbers("unresolved")))
+}
+
+// Returns a table of failed and unresolved test cases, or empty string when there is none
+func formatFailedTestCases(batchRun *magicpod.BatchRun) string {
+	var builder strings.Builder
+	writer := tabwriter.NewWriter(&builder, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "No.\tName\tStatus\tRetries\tDuration\tMessage")
+	count := 0
+	for _, result := range batchRun.TestCases.Details {
+		if result.Status != "failed" && result.Status != "unresolved" {
+			continue
+		}
+		message := strings.Replace(result.Message, "\n", " ", -1)
+		fmt.Fprintf(writer, "#%d\t%s\t%s\t%d\t%.1fs\t%s\n",
+			result.Number, result.Name, result.Status, result.RetryCount, result.Duration, message)
+		count++
+	}
+	if count == 0 {
+		return ""
+	}
+	writer.Flush()
+	return builder.String()
+}
+
+func printFailedTestCases(batchRun *magicpod.BatchRun) {
+	table := formatFailedTestCases(batchRun)
+	if table == "" {
+		return
+	}
+	log.Warnf("Failed and unresolved test cases:")
+	fmt.Print(table)
+}
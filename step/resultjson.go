@@ -0,0 +1,200 @@
+package step
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+// Version of the result JSON document. Increment it when the document changes incompatibly,
+// adding fields is compatible
+const resultJSONVersion = 1
+
+// Result JSON document written for downstream steps, exported as MAGIC_POD_TEST_RESULT_JSON
+type resultDocument struct {
+	Version        int              `json:"version"`
+	Status         string           `json:"status"`
+	Decision       string           `json:"decision"` // passed or failed, decided by the pass policy
+	DecisionReason string           `json:"decision_reason"`
+	Counts         resultCounts     `json:"counts"`
+	BatchRuns      []batchRunResult `json:"batch_runs"` // one per device of the device matrix, or only one without it
+	Shard          *resultShard     `json:"shard,omitempty"`
+}
+
+// Shard executed by this step, so that results of all shards can be merged by a later step
+type resultShard struct {
+	Index           int    `json:"index"`
+	Count           int    `json:"count"`
+	Strategy        string `json:"strategy"`
+	TestCaseNumbers []int  `json:"test_case_numbers"`
+}
+
+type resultCounts struct {
+	Succeeded  int `json:"succeeded"`
+	Failed     int `json:"failed"`
+	Unresolved int `json:"unresolved"`
+	Total      int `json:"total"`
+}
+
+type batchRunResult struct {
+	Name            string                    `json:"name,omitempty"`
+	BatchRunNumber  int                       `json:"batch_run_number,omitempty"`
+	URL             string                    `json:"url,omitempty"`
+	Status          string                    `json:"status"`
+	Decision        string                    `json:"decision"`
+	DecisionReason  string                    `json:"decision_reason"`
+	Error           string                    `json:"error,omitempty"`
+	StartedAt       *time.Time                `json:"started_at,omitempty"` // absent when the batch run was started by another step
+	FinishedAt      *time.Time                `json:"finished_at,omitempty"`
+	DurationSeconds float64                   `json:"duration_seconds"`
+	Device          resultDevice              `json:"device"`
+	Counts          resultCounts              `json:"counts"`
+	TestCases       []magicpod.TestCaseResult `json:"test_cases"`
+}
+
+type resultDevice struct {
+	Environment    string `json:"environment"`
+	OsName         string `json:"os"`
+	DeviceType     string `json:"device_type"`
+	Version        string `json:"version"`
+	Model          string `json:"model"`
+	AppType        string `json:"app_type"`
+	DeviceLanguage string `json:"device_language"`
+	DeviceRegion   string `json:"device_region"`
+}
+
+func newResultDocument(cfg Config, status string, decision passDecision, runs []*deviceRun) *resultDocument {
+	document := &resultDocument{
+		Version:        resultJSONVersion,
+		Status:         status,
+		Decision:       decision.String(),
+		DecisionReason: decision.reason,
+		BatchRuns:      []batchRunResult{},
+	}
+	if shard, _ := newShardConfig(cfg); shard.enabled() {
+		document.Shard = &resultShard{shard.index, shard.count, shard.strategy, cfg.TestCaseNumbersList}
+	}
+	for _, run := range runs {
+		result := batchRunResult{
+			Name:           run.name,
+			Status:         run.status,
+			Decision:       run.decision.String(),
+			DecisionReason: run.decision.reason,
+			Device: resultDevice{
+				Environment:    run.cfg.Environment,
+				OsName:         run.cfg.OsName,
+				DeviceType:     run.cfg.DeviceType,
+				Version:        run.cfg.Version,
+				Model:          run.cfg.Model,
+				AppType:        run.cfg.AppType,
+				DeviceLanguage: run.cfg.DeviceLanguage,
+				DeviceRegion:   run.cfg.DeviceRegion,
+			},
+			TestCases: []magicpod.TestCaseResult{},
+		}
+		if !run.startedAt.IsZero() {
+			startedAt := run.startedAt.UTC().Truncate(time.Second)
+			result.StartedAt = &startedAt
+		}
+		if !run.finishedAt.IsZero() {
+			finishedAt := run.finishedAt.UTC().Truncate(time.Second)
+			result.FinishedAt = &finishedAt
+		}
+		if !run.startedAt.IsZero() && !run.finishedAt.IsZero() {
+			result.DurationSeconds = run.finishedAt.Sub(run.startedAt).Round(time.Second).Seconds()
+		}
+		if run.err != nil {
+			result.Error = run.err.Error()
+		}
+		if run.batchRun != nil {
+			testCases := run.batchRun.TestCases
+			result.BatchRunNumber = run.batchRun.BatchRunNumber
+			result.URL = run.batchRun.URL
+			result.Counts = resultCounts{testCases.Succeeded, testCases.Failed, testCases.Unresolved, testCases.Total}
+			if testCases.Details != nil {
+				result.TestCases = testCases.Details
+			}
+		}
+		document.Counts.Succeeded += result.Counts.Succeeded
+		document.Counts.Failed += result.Counts.Failed
+		document.Counts.Unresolved += result.Counts.Unresolved
+		document.Counts.Total += result.Counts.Total
+		document.BatchRuns = append(document.BatchRuns, result)
+	}
+	return document
+}
+
+// Writes the result JSON into `deploy_dir` (or the temporary directory when it is empty) and exports its path.
+// Each shard writes its own file so that they do not overwrite each other when collected into one place
+func exportResultJSON(cfg Config, status string, decision passDecision, runs []*deviceRun) {
+	dir := cfg.DeployDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	document := newResultDocument(cfg, status, decision, runs)
+	exportSummary(document.markdown())
+	if err := encoder.Encode(document); err != nil {
+		log.Warnf("Failed to export result JSON, error: %s", err)
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Warnf("Failed to export result JSON, error: %s", err)
+		return
+	}
+	name := "magicpod-result.json"
+	if shard, _ := newShardConfig(cfg); shard.enabled() {
+		name = fmt.Sprintf("magicpod-result-shard-%d.json", shard.index)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data.Bytes(), 0644); err != nil {
+		log.Warnf("Failed to export result JSON, error: %s", err)
+		return
+	}
+	exportOutput(outputTestResultJSON, path)
+	log.Donef("Test result JSON is exported to %s", path)
+}
+
+// Markdown summary of the document for the CI services which show it on the job page
+func (document *resultDocument) markdown() string {
+	var builder strings.Builder
+	title := "Magic Pod test result"
+	if document.Shard != nil {
+		title += fmt.Sprintf(" (shard %d/%d)", document.Shard.Index, document.Shard.Count)
+	}
+	fmt.Fprintf(&builder, "### %s: %s\n\n", title, document.Decision)
+	if document.DecisionReason != "" {
+		fmt.Fprintf(&builder, "%s\n\n", document.DecisionReason)
+	}
+	if len(document.BatchRuns) == 0 {
+		return builder.String()
+	}
+	builder.WriteString("| Batch run | Device | Status | Succeeded | Failed | Unresolved | Total |\n")
+	builder.WriteString("| --- | --- | --- | ---: | ---: | ---: | ---: |\n")
+	for _, result := range document.BatchRuns {
+		name := result.Name
+		if result.BatchRunNumber != 0 {
+			name = fmt.Sprintf("[#%d](%s)", result.BatchRunNumber, result.URL)
+			// Names of the batch runs waited by `mode: wait` are their numbers
+			if result.Name != "" && result.Name != fmt.Sprintf("#%d", result.BatchRunNumber) {
+				name = result.Name + " " + name
+			}
+		}
+		device := result.Device
+		fmt.Fprintf(&builder, "| %s | %s %s %s %s | %s | %d | %d | %d | %d |\n", name,
+			device.OsName, device.Version, device.Model, device.DeviceType, result.Status,
+			result.Counts.Succeeded, result.Counts.Failed, result.Counts.Unresolved, result.Counts.Total)
+	}
+	return builder.String()
+}
@@ -0,0 +1,170 @@
+package step
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+const (
+	// How many finished batch runs are read for the durations of test cases
+	shardHistoryCount = 5
+	// Duration in seconds assumed for test cases which have never been executed, when no duration is known at all
+	defaultTestCaseDuration = 60.0
+)
+
+// Splits the test cases into `shard_count` shards, and executes only the shard of `shard_index`.
+// Every shard computes the same split independently, so it must not depend on anything but the inputs and the API
+type shardConfig struct {
+	index    int
+	count    int // 0 when sharding is disabled
+	strategy string
+}
+
+func newShardConfig(cfg Config) (*shardConfig, []error) {
+	errors := []error{}
+	shard := &shardConfig{}
+	index := strings.TrimSpace(cfg.ShardIndex)
+	count := strings.TrimSpace(cfg.ShardCount)
+	if index == "" && count == "" {
+		return shard, errors
+	}
+	if index == "" || count == "" {
+		return shard, append(errors, fmt.Errorf("Shard index and Shard count should be specified together"))
+	}
+
+	var err error
+	if shard.count, err = strconv.Atoi(count); err != nil || shard.count <= 0 {
+		errors = append(errors, fmt.Errorf("Shard count %s should be a positive integer", count))
+		shard.count = 0
+	}
+	if shard.index, err = strconv.Atoi(index); err != nil || shard.index < 0 || (shard.count > 0 && shard.index >= shard.count) {
+		errors = append(errors, fmt.Errorf("Shard index %s should be an integer from 0 to Shard count - 1", index))
+	}
+	if shard.strategy, err = convertChoiceParam("Shard strategy", cfg.ShardStrategy, "round_robin", "duration"); err != nil {
+		errors = append(errors, err)
+	}
+	return shard, errors
+}
+
+func (shard *shardConfig) enabled() bool {
+	return shard.count > 0
+}
+
+func (shard *shardConfig) String() string {
+	return fmt.Sprintf("shard %d of %d", shard.index, shard.count)
+}
+
+// Numbers of the test cases assigned to this shard, out of `numbers` or all test cases of the project when it is empty
+func (shard *shardConfig) testCaseNumbers(client *magicpod.Client, numbers []int) ([]int, error) {
+	if len(numbers) == 0 {
+		testCases, err := client.ListTestCases()
+		if err != nil {
+			return nil, err
+		}
+		numbers = testCaseNumbersOf(testCases)
+		sort.Ints(numbers)
+	}
+
+	assigned := map[int]int{}
+	switch shard.strategy {
+	case "duration":
+		durations, err := testCaseDurations(client)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get durations of test cases, error: %s", err)
+		}
+		assigned = shard.splitByDuration(numbers, durations)
+	default:
+		for i, number := range numbers {
+			assigned[number] = i % shard.count
+		}
+	}
+
+	result := []int{}
+	for _, number := range numbers {
+		if assigned[number] == shard.index {
+			result = append(result, number)
+		}
+	}
+	return result, nil
+}
+
+// Assigns the longest test case first to the shard with the shortest total duration, so that shards finish at similar times
+func (shard *shardConfig) splitByDuration(numbers []int, durations map[int]float64) map[int]int {
+	fallback := defaultTestCaseDuration
+	if len(durations) != 0 {
+		sum := 0.0
+		for _, duration := range durations {
+			sum += duration
+		}
+		fallback = sum / float64(len(durations))
+	}
+	duration := func(number int) float64 {
+		if duration, ok := durations[number]; ok {
+			return duration
+		}
+		return fallback
+	}
+
+	sorted := append([]int{}, numbers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if duration(sorted[i]) != duration(sorted[j]) {
+			return duration(sorted[i]) > duration(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+	totals := make([]float64, shard.count)
+	counts := make([]int, shard.count)
+	assigned := map[int]int{}
+	for _, number := range sorted {
+		shortest := 0
+		for i := range totals {
+			if totals[i] < totals[shortest] {
+				shortest = i
+			}
+		}
+		assigned[number] = shortest
+		totals[shortest] += duration(number)
+		counts[shortest]++
+	}
+	for i := range totals {
+		log.Printf("- Shard %d: %d test cases, %.0f seconds estimated", i, counts[i], totals[i])
+	}
+	return assigned
+}
+
+// Average durations of test cases in the latest finished batch runs
+func testCaseDurations(client *magicpod.Client) (map[int]float64, error) {
+	batchRuns, err := client.ListBatchRuns(latestBatchRunSearchCount)
+	if err != nil {
+		return nil, err
+	}
+	sums := map[int]float64{}
+	counts := map[int]int{}
+	read := 0
+	for _, summary := range batchRuns {
+		if summary.Status == "running" || read == shardHistoryCount {
+			continue
+		}
+		batchRun, err := client.GetBatchRun(summary.BatchRunNumber)
+		if err != nil {
+			return nil, err
+		}
+		read++
+		for _, result := range batchRun.TestCases.Details {
+			if result.Duration > 0 {
+				sums[result.Number] += result.Duration
+				counts[result.Number]++
+			}
+		}
+	}
+	durations := map[int]float64{}
+	for number, sum := range sums {
+		durations[number] = sum / float64(counts[number])
+	}
+	return durations, nil
+}
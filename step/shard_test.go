@@ -0,0 +1,161 @@
+package step
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod/fakeserver"
+)
+
+func newFakeClient(t *testing.T, scenario fakeserver.Scenario) *magicpod.Client {
+	server := httptest.NewServer(fakeserver.New(scenario))
+	t.Cleanup(server.Close)
+	return magicpod.NewClient(server.URL+"/api/v1.0", "", "Org", "Prj", nil)
+}
+
+func newTestShardConfig(t *testing.T, index, count, strategy string) *shardConfig {
+	shard, errors := newShardConfig(Config{ShardIndex: index, ShardCount: count, ShardStrategy: strategy})
+	if len(errors) != 0 {
+		t.Fatalf("newShardConfig() errors = %v", errors)
+	}
+	return shard
+}
+
+// Splits the numbers with every shard, and checks that each number is assigned to exactly one shard.
+// Numbers can be nil to split all test cases of the project
+func splitIntoShards(t *testing.T, client *magicpod.Client, numbers []int, count, strategy string) [][]int {
+	shards := [][]int{}
+	seen := map[int]int{}
+	for index := 0; ; index++ {
+		shard := newTestShardConfig(t, strconv.Itoa(index), count, strategy)
+		assigned, err := shard.testCaseNumbers(client, numbers)
+		if err != nil {
+			t.Fatalf("testCaseNumbers() error = %v", err)
+		}
+		for _, number := range assigned {
+			seen[number]++
+		}
+		shards = append(shards, assigned)
+		if index == shard.count-1 {
+			break
+		}
+	}
+	all := []int{}
+	for number, times := range seen {
+		if times != 1 {
+			t.Errorf("test case #%d is assigned to %d shards", number, times)
+		}
+		all = append(all, number)
+	}
+	sort.Ints(all)
+	want := append([]int{}, numbers...)
+	sort.Ints(want)
+	if numbers != nil && !reflect.DeepEqual(all, want) {
+		t.Errorf("shards cover %v, want %v", all, want)
+	}
+	return shards
+}
+
+func TestShardRoundRobin(t *testing.T) {
+	client := newFakeClient(t, fakeserver.Scenario{})
+	numbers := []int{5, 3, 9, 1, 7, 2, 8}
+	shards := splitIntoShards(t, client, numbers, "3", "round_robin")
+	want := [][]int{{5, 1, 8}, {3, 7}, {9, 2}}
+	if !reflect.DeepEqual(shards, want) {
+		t.Errorf("shards = %v, want %v", shards, want)
+	}
+	// Every shard computes the split independently, so it must be the same every time
+	if again := splitIntoShards(t, client, numbers, "3", "round_robin"); !reflect.DeepEqual(again, shards) {
+		t.Errorf("shards = %v at the second time, want %v", again, shards)
+	}
+}
+
+func TestShardMoreShardsThanTestCases(t *testing.T) {
+	shards := splitIntoShards(t, newFakeClient(t, fakeserver.Scenario{}), []int{1, 2}, "4", "round_robin")
+	if want := [][]int{{1}, {2}, {}, {}}; !reflect.DeepEqual(shards, want) {
+		t.Errorf("shards = %v, want %v", shards, want)
+	}
+}
+
+func TestShardAllTestCasesOfProject(t *testing.T) {
+	client := newFakeClient(t, fakeserver.Scenario{TestCaseList: []magicpod.TestCase{{Number: 4}, {Number: 1}, {Number: 3}, {Number: 2}}})
+	shards := splitIntoShards(t, client, nil, "2", "round_robin")
+	if want := [][]int{{1, 3}, {2, 4}}; !reflect.DeepEqual(shards, want) {
+		t.Errorf("shards = %v, want %v", shards, want)
+	}
+}
+
+func TestShardByDuration(t *testing.T) {
+	results := []magicpod.TestCaseResult{
+		{Number: 1, Status: "succeeded", Duration: 100},
+		{Number: 2, Status: "succeeded", Duration: 60},
+		{Number: 3, Status: "succeeded", Duration: 50},
+		{Number: 4, Status: "failed", Duration: 40},
+		{Number: 5, Status: "succeeded", Duration: 10},
+	}
+	// The second batch run makes the average duration of #1 80 seconds
+	slower := append([]magicpod.TestCaseResult{}, results...)
+	slower[0].Duration = 60
+	client := newFakeClient(t, fakeserver.Scenario{Results: results, BatchRunResults: map[int][]magicpod.TestCaseResult{2: slower}})
+	for i := 1; i <= 2; i++ {
+		if _, err := client.StartBatchRun(map[string]interface{}{
+			"environment": "magic_pod", "os": "ios", "device_type": "simulator", "app_type": "app_url",
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.GetBatchRun(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// #6 has never been executed, so it is assumed to take the average 48 seconds
+	numbers := []int{1, 2, 3, 4, 5, 6}
+	shards := splitIntoShards(t, client, numbers, "2", "duration")
+	// Longest first to the shorter shard: #1 (80) -> 0, #2 (60) -> 1, #3 (50) -> 1, #6 (48) -> 0, #4 (40) -> 1, #5 (10) -> 0
+	if want := [][]int{{1, 5, 6}, {2, 3, 4}}; !reflect.DeepEqual(shards, want) {
+		t.Errorf("shards = %v, want %v", shards, want)
+	}
+	if again := splitIntoShards(t, client, numbers, "2", "duration"); !reflect.DeepEqual(again, shards) {
+		t.Errorf("shards = %v at the second time, want %v", again, shards)
+	}
+}
+
+func TestShardByDurationWithoutHistory(t *testing.T) {
+	// All test cases are assumed to take the same time, so they are assigned in the order of their numbers,
+	// and listed in the order of the input
+	shards := splitIntoShards(t, newFakeClient(t, fakeserver.Scenario{}), []int{3, 1, 2, 4, 5}, "2", "duration")
+	if want := [][]int{{3, 1, 5}, {2, 4}}; !reflect.DeepEqual(shards, want) {
+		t.Errorf("shards = %v, want %v", shards, want)
+	}
+}
+
+func TestNewShardConfigErrors(t *testing.T) {
+	tests := []struct {
+		index, count, strategy string
+		errors                 int
+	}{
+		{"", "", "", 0},
+		{"0", "1", "", 0},
+		{"2", "3", "duration", 0},
+		{"0", "", "", 1},
+		{"", "2", "", 1},
+		{"2", "2", "", 1},
+		{"-1", "2", "", 1},
+		{"0", "0", "", 1},
+		{"x", "y", "", 2},
+		{"0", "2", "random", 1},
+	}
+	for _, test := range tests {
+		shard, errors := newShardConfig(Config{ShardIndex: test.index, ShardCount: test.count, ShardStrategy: test.strategy})
+		if len(errors) != test.errors {
+			t.Errorf("newShardConfig(%q, %q, %q) errors = %v, want %d errors", test.index, test.count, test.strategy, errors, test.errors)
+		}
+		if test.errors == 0 && shard.enabled() != (test.count != "") {
+			t.Errorf("newShardConfig(%q, %q, %q).enabled() = %v", test.index, test.count, test.strategy, shard.enabled())
+		}
+	}
+}
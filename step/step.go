@@ -0,0 +1,668 @@
+// Package step implements the Bitrise step on top of the magicpod package. The step (main.go of the repository root)
+// and the command line tool (cmd/magicpod) only parse the inputs into Config and call the functions of this package.
+package step
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/bitrise-tools/go-steputils/stepconf"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+	"github.com/mholt/archiver"
+)
+
+// Config : Configuration for this step
+type Config struct {
+	BaseURL                  string          `env:"base_url,required"`
+	APIToken                 stepconf.Secret `env:"magic_pod_api_token,required"`
+	OrganizationName         string          `env:"organization_name,required"`
+	ProjectName              string          `env:"project_name,required"`
+	Environment              string          `env:"environment,required"`
+	ExternalServiceToken     stepconf.Secret `env:"external_service_token"`
+	ExternalServiceServerURL string          `env:"external_service_server_url"`
+	ExternalServiceUserName  string          `env:"external_service_user_name"`
+	ExternalServicePassword  stepconf.Secret `env:"external_service_password"`
+	OsName                   string          `env:"os,required"`
+	DeviceType               string          `env:"device_type,required"`
+	Version                  string          `env:"version,required"`
+	Model                    string          `env:"model,required"`
+	AppType                  string          `env:"app_type,required"`
+	AppPath                  string          `env:"app_path"`
+	UploadCacheDir           string          `env:"upload_cache_dir"`
+	UploadRetryCount         int             `env:"upload_retry_count"`
+	UploadTimeout            int             `env:"upload_timeout"`
+	AppURL                   string          `env:"app_url"`
+	BundleID                 string          `env:"bundle_id"`
+	AppPackage               string          `env:"app_package"`
+	AppActivity              string          `env:"app_activity"`
+	Mode                     string          `env:"mode"`
+	WaitForResult            bool            `env:"wait_for_result"`
+	BatchRunNumbers          string          `env:"batch_run_numbers"`
+	BatchRunNumbersList      []int           // set after stepConf parsing
+	PollInterval             int             `env:"poll_interval"`
+	MaxPollInterval          int             `env:"max_poll_interval"`
+	PollBackoff              bool            `env:"poll_backoff"`
+	MaxWaitTime              int             `env:"max_wait_time"`
+	DeviceMatrix             string          `env:"device_matrix"`
+	MatrixFailPolicy         string          `env:"matrix_fail_policy"`
+	CancelOnAbort            bool            `env:"cancel_on_abort"`
+	TestResultDir            string          `env:"test_result_dir"`
+	DownloadArtifacts        string          `env:"download_artifacts"`
+	DownloadConcurrency      int             `env:"download_concurrency"`
+	DownloadMaxSizeMB        int             `env:"download_max_size_mb"`
+	DeployDir                string          `env:"deploy_dir"`
+	OutputSinks              string          `env:"output_sinks"`
+	OutputFile               string          `env:"output_file"`
+	DryRun                   bool            `env:"dry_run"`
+	AllowedFailures          string          `env:"allowed_failures"`
+	UnresolvedPolicy         string          `env:"unresolved_policy"`
+	QuarantinedTestNumbers   string          `env:"quarantined_test_numbers"`
+	CriticalTestNumbers      string          `env:"critical_test_numbers"`
+	SendMail                 string          `env:"send_mail"`
+	TestCaseNumbers          string          `env:"test_case_numbers"`
+	TestCaseNumbersList      []int           // set after stepConf parsing
+	TestCaseNames            string          `env:"test_case_names"`
+	TestCaseFolders          string          `env:"test_case_folders"`
+	TestCaseLabels           string          `env:"test_case_labels"`
+	ShardIndex               string          `env:"shard_index"`
+	ShardCount               string          `env:"shard_count"`
+	ShardStrategy            string          `env:"shard_strategy"`
+	ReattachBatchRun         bool            `env:"reattach_batch_run"`
+	ReattachStateDir         string          `env:"reattach_state_dir"`
+	AppContentHash           string          // set by hashApp before reattaching and uploading
+	RerunFailedFrom          string          `env:"rerun_failed_from"`
+	AutoRerunFailed          bool            `env:"auto_rerun_failed"`
+	RetryCount               int             `env:"retry_count"`
+	CaptureType              string          `env:"capture_type,required"`
+	DeviceLanguage           string          `env:"device_language"`
+	DeviceRegion             string          `env:"device_region"`
+	MultiLangData            string          `env:"multi_lang_data"`
+}
+
+func failf(format string, v ...interface{}) {
+	log.Errorf(format, v...)
+	os.Exit(1)
+}
+
+// Converts parameters for API call but also validates if any of parameters has a `unselectable` value from GUI(e.g. Okinawa dialect for `Device Language`).
+// We prefer not to validate parameters because it duplicates the API logic on server
+func (cfg *Config) convertToAPIParams() []error {
+	var err error
+	errors := []error{}
+	cfg.Environment, err = convertEnvironmentParam(cfg.Environment)
+	if err != nil {
+		errors = append(errors, err)
+	}
+	cfg.OsName = convertToSnakeCase(cfg.OsName)
+	cfg.DeviceType = convertToSnakeCase(cfg.DeviceType)
+	cfg.AppType, err = convertAppTypeParam(cfg.AppType)
+	if err != nil {
+		errors = append(errors, err)
+	}
+	cfg.Mode, err = convertModeParam(cfg.Mode, cfg.WaitForResult)
+	if err != nil {
+		errors = append(errors, err)
+	}
+	// `wait_for_result` follows `mode` so that waiting is decided in one place
+	cfg.WaitForResult = cfg.Mode != "start"
+	if cfg.Mode == "wait" {
+		cfg.BatchRunNumbersList, err = convertBatchRunNumbers(cfg.BatchRunNumbers)
+		if err != nil {
+			errors = append(errors, err)
+		}
+	}
+	cfg.OutputSinks, err = convertOutputSinksParam(cfg.OutputSinks, cfg.OutputFile)
+	if err != nil {
+		errors = append(errors, err)
+	}
+	cfg.TestCaseNumbersList, err = convertTestCaseNumber(cfg.TestCaseNumbers)
+	if err != nil {
+		errors = append(errors, err)
+	}
+	cfg.RerunFailedFrom, err = convertRerunFailedFromParam(strings.TrimSpace(cfg.RerunFailedFrom))
+	if err != nil {
+		errors = append(errors, err)
+	}
+	cfg.CaptureType, err = convertCaptureTypeParam(cfg.CaptureType)
+	if err != nil {
+		errors = append(errors, err)
+	}
+	cfg.DeviceLanguage, err = convertDeviceLanguageParam(cfg.DeviceLanguage)
+	if err != nil {
+		errors = append(errors, err)
+	}
+	cfg.DeviceRegion, err = convertDeviceRegionParam(cfg.DeviceRegion)
+	if err != nil {
+		errors = append(errors, err)
+	}
+	cfg.DownloadArtifacts, err = convertChoiceParam("Download artifacts", cfg.DownloadArtifacts, "none", "failed", "all")
+	if err != nil {
+		errors = append(errors, err)
+	}
+	cfg.MatrixFailPolicy, err = convertChoiceParam("Device matrix fail policy", cfg.MatrixFailPolicy, "any", "all")
+	if err != nil {
+		errors = append(errors, err)
+	}
+	return errors
+}
+
+func convertToSnakeCase(input string) string {
+	converted := strings.ToLower(input)
+	converted = strings.Replace(converted, " ", "_", -1)
+
+	return converted
+}
+
+// Validates a step-only parameter which has the choices. Empty input means the first choice
+func convertChoiceParam(title, input string, choices ...string) (string, error) {
+	if input == "" {
+		return choices[0], nil
+	}
+	for _, choice := range choices {
+		if input == choice {
+			return input, nil
+		}
+	}
+	return "", fmt.Errorf("%s should be either of '%s'", title, strings.Join(choices, "', '"))
+}
+
+func convertEnvironmentParam(input string) (string, error) {
+	switch input {
+	case "Magic Pod":
+		return "magic_pod", nil
+	case "Remote TestKit":
+		return "remote_testkit", nil
+	case "Remote TestKit Onpremise":
+		return "remote_testkit_onpremise", nil
+	default:
+		return "", errors.New("Environment should be 'Magic Pod', 'Remote TestKit' or 'Remote TestKit Onpremise'")
+	}
+}
+
+func convertAppTypeParam(input string) (string, error) {
+	switch input {
+	case "App file (cloud upload)":
+		return "app_file", nil
+	case "App file (URL)":
+		return "app_url", nil
+	case "Installed app":
+		return "installed", nil
+	default:
+		return "", errors.New("App type should be either of 'App file (cloud upload)', 'App file (URL)', or 'Installed app'")
+	}
+}
+
+func convertCaptureTypeParam(input string) (string, error) {
+	switch input {
+	case "Every step":
+		return "on_each_step", nil
+	case "Every UI transit":
+		return "on_ui_transit", nil
+	case "Failure capture only":
+		return "on_error", nil
+	default:
+		return "", errors.New("Capture type should be either of 'Every step', 'Every UI transit', or 'Failure capture only'")
+	}
+}
+
+func convertDeviceLanguageParam(input string) (string, error) {
+	switch input {
+	case "Default":
+		return "default", nil
+	case "English":
+		return "en", nil
+	case "Japanese":
+		return "ja", nil
+	case "Korean":
+		return "ko", nil
+	default:
+		return "", errors.New("Device language should be 'Default', 'English', 'Japanese' or 'Korean'")
+	}
+}
+
+func convertDeviceRegionParam(input string) (string, error) {
+	switch input {
+	case "Default":
+		return "Default", nil
+	case "Australia":
+		return "AU", nil
+	case "Brazil":
+		return "BR", nil
+	case "Canada":
+		return "CA", nil
+	case "China mainland":
+		return "CN", nil
+	case "France":
+		return "FR", nil
+	case "Germany":
+		return "DE", nil
+	case "India":
+		return "IN", nil
+	case "Indonesia":
+		return "ID", nil
+	case "Italy":
+		return "IT", nil
+	case "Japan":
+		return "JP", nil
+	case "Mexico":
+		return "MX", nil
+	case "Netherlands":
+		return "NL", nil
+	case "Russia":
+		return "RU", nil
+	case "Saudi Arabia":
+		return "SA", nil
+	case "South Korea":
+		return "KR", nil
+	case "Spain":
+		return "ES", nil
+	case "Switzerland":
+		return "CH", nil
+	case "Taiwan":
+		return "TW", nil
+	case "Turkey":
+		return "TR", nil
+	case "United Kingdom":
+		return "GB", nil
+	case "United States":
+		return "US", nil
+	default:
+		return "", errors.New("Invalid Device Region")
+	}
+}
+
+func createStartBatchRunParams(cfg Config, appFileNumber int) map[string]interface{} {
+	params := map[string]interface{}{}
+
+	params["environment"] = cfg.Environment
+	if cfg.Environment == "remote_testkit" {
+		params["external_service_token"] = cfg.ExternalServiceToken
+	} else if cfg.Environment == "remote_testkit_onpremise" {
+		params["external_service_server_url"] = cfg.ExternalServiceServerURL
+		params["external_service_user_name"] = cfg.ExternalServiceUserName
+		params["external_service_password"] = cfg.ExternalServicePassword
+	}
+	params["os"] = cfg.OsName
+	params["device_type"] = cfg.DeviceType
+	params["version"] = cfg.Version
+	params["model"] = cfg.Model
+	params["app_type"] = cfg.AppType
+	switch cfg.AppType {
+	case "app_file":
+		params["app_file_number"] = appFileNumber
+		if cfg.OsName == "ios" {
+			if cfg.Environment == "remote_testkit" {
+				params["bundle_id"] = cfg.BundleID
+			} else if cfg.Environment == "remote_testkit_onpremise" {
+				params["bundle_id"] = cfg.BundleID
+			}
+		}
+		break
+	case "app_url":
+		params["app_url"] = cfg.AppURL
+		if cfg.OsName == "ios" {
+			if cfg.Environment == "remote_testkit" {
+				params["bundle_id"] = cfg.BundleID
+			} else if cfg.Environment == "remote_testkit_onpremise" {
+				params["bundle_id"] = cfg.BundleID
+			}
+		}
+		break
+	case "installed":
+		if cfg.OsName == "ios" {
+			params["bundle_id"] = cfg.BundleID
+		} else {
+			params["app_package"] = cfg.AppPackage
+			params["app_activity"] = cfg.AppActivity
+		}
+		break
+	}
+	params["send_mail"] = cfg.SendMail
+	params["test_case_numbers"] = cfg.TestCaseNumbersList
+	params["retry_count"] = cfg.RetryCount
+	params["capture_type"] = cfg.CaptureType
+	params["device_language"] = cfg.DeviceLanguage
+	params["device_region"] = cfg.DeviceRegion
+	if cfg.MultiLangData != "" {
+		params["shared_data_pattern"] = map[string]string{"multi_lang_data": cfg.MultiLangData}
+	}
+
+	return params
+}
+
+func createClient(cfg Config) *magicpod.Client {
+	return magicpod.NewClient(cfg.BaseURL, string(cfg.APIToken), cfg.OrganizationName, cfg.ProjectName, nil)
+}
+
+func zipAppDir(dirPath string) (string, error) {
+	log.Infof("Zip app directory %s", dirPath)
+	zipPath := dirPath + ".zip"
+	if err := os.RemoveAll(zipPath); err != nil {
+		return "", err
+	}
+	if err := archiver.Archive([]string{dirPath}, zipPath); err != nil {
+		return "", err
+	}
+	fmt.Println()
+	return zipPath, nil
+}
+
+// Returns the path of the file to upload, which is zipped for iOS simulator
+func prepareAppFile(cfg Config) (string, error) {
+	if cfg.OsName == "ios" && cfg.DeviceType == "simulator" {
+		return zipAppDir(cfg.AppPath)
+	}
+	return cfg.AppPath, nil
+}
+
+func uploadAppFile(cfg Config, client *magicpod.Client) (int, error) {
+	// The app is identified by its contents before zipping, because the zip has modification times of the files
+	var cache *uploadCache
+	hash := cfg.AppContentHash
+	if cfg.UploadCacheDir != "" {
+		if hash == "" {
+			var err error
+			if hash, err = hashAppContents(cfg.AppPath); err != nil {
+				return 0, err
+			}
+		}
+		cache = loadUploadCache(cfg.UploadCacheDir)
+		if fileNo := findUploadedFile(cfg, client, cache, hash); fileNo != 0 {
+			log.Donef("Skip uploading %s because the identical app has been uploaded. File number = %d\n", cfg.AppPath, fileNo)
+			return fileNo, nil
+		}
+	}
+
+	appPath, err := prepareAppFile(cfg)
+	if err != nil {
+		return 0, err
+	}
+	log.Infof("Upload app file %s to Magic Pod cloud", appPath)
+
+	uploadFile, err := client.UploadFileWithOptions(appPath, magicpod.UploadOptions{
+		Retries:    cfg.UploadRetryCount,
+		Timeout:    time.Duration(cfg.UploadTimeout) * time.Second,
+		OnProgress: newUploadProgressLogger(),
+		OnRetry: func(attempt int, wait time.Duration, err error) {
+			log.Warnf("Failed to upload: %s", err)
+			log.Warnf("Retry (%d/%d) in %s", attempt, cfg.UploadRetryCount, wait)
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	log.Donef("Done. File number = %d\n", uploadFile.FileNo)
+	if cache != nil {
+		rememberUploadedFile(cfg, cache, hash, uploadFile)
+	}
+	return uploadFile.FileNo, nil
+}
+
+// Returns a callback of upload progress which logs every 10% or 10 seconds, so that
+// uploading a large app doesn't hit the no-output timeout of Bitrise
+func newUploadProgressLogger() func(sent, total int64) {
+	start := time.Now()
+	lastLogged := start
+	lastPercent, lastSent := int64(0), int64(0)
+	return func(sent, total int64) {
+		if sent <= lastSent {
+			// Restarted by retry
+			start, lastLogged, lastPercent = time.Now(), time.Now(), 0
+		}
+		lastSent = sent
+		percent := sent * 100 / total
+		if percent/10 == lastPercent/10 && time.Since(lastLogged) < 10*time.Second && sent != total {
+			return
+		}
+		lastLogged, lastPercent = time.Now(), percent
+		const mb = 1024 * 1024
+		speed := float64(sent) / mb / time.Since(start).Seconds()
+		log.Printf("Uploaded %3d%% (%.1f / %.1f MB, %.1f MB/s)", percent, float64(sent)/mb, float64(total)/mb, speed)
+	}
+}
+
+func startBatchRun(cfg Config, client *magicpod.Client, appFileNumber int) (*magicpod.BatchRun, error) {
+	log.Infof("Start batch run")
+	batchRun, err := client.StartBatchRun(createStartBatchRunParams(cfg, appFileNumber))
+	if err != nil {
+		return nil, err
+	}
+	rememberStartedBatchRun(cfg, batchRun, appFileNumber, time.Now())
+	return batchRun, nil
+}
+
+// startedAt is zero when the batch run was started by another step
+func waitBatchRun(cfg Config, client *magicpod.Client, canceller *batchRunCanceller, batchRun *magicpod.BatchRun, startedAt time.Time) *magicpod.BatchRun {
+	opts := magicpod.WaitOptions{
+		Interval:    time.Duration(cfg.PollInterval) * time.Second,
+		Backoff:     cfg.PollBackoff,
+		MaxInterval: time.Duration(cfg.MaxPollInterval) * time.Second,
+		Timeout:     time.Duration(cfg.MaxWaitTime) * time.Second,
+		OnPoll: func(*magicpod.BatchRun) {
+			print(".")
+		},
+	}
+	finished, err := client.WaitBatchRun(context.Background(), batchRun.BatchRunNumber, opts)
+	if err != nil {
+		if timeoutErr, ok := err.(*magicpod.TimeoutError); ok {
+			// The last polled batch run has the test cases finished so far
+			batchRun = timeoutErr.BatchRun
+			decision := passDecision{false, "batch run did not finish within max wait time"}
+			exportOutput(outputTestStatus, "timeout")
+			exportResultJSON(cfg, "timeout", decision, []*deviceRun{
+				{cfg: cfg, batchRun: batchRun, status: "timeout", decision: decision, startedAt: startedAt, finishedAt: time.Now()},
+			})
+			exportDecision(decision)
+			log.Errorf("\nMagic Pod test timed out: batch run #%d did not finish within %d seconds.\n"+
+				"Please see %s for detail", batchRun.BatchRunNumber, cfg.MaxWaitTime, batchRun.URL)
+			canceller.cancel()
+			os.Exit(1)
+		}
+		failf(err.Error())
+	}
+	fmt.Println()
+	return finished
+}
+
+// Run : Runs this step with the configuration parsed from the step inputs. It exits the process when finished
+func Run(cfg Config) {
+	var matrixCfgs []Config
+	var matrixNames []string
+	if cfg.DeviceMatrix != "" {
+		var err error
+		matrixCfgs, matrixNames, err = parseDeviceMatrix(cfg)
+		if err != nil {
+			failf(err.Error())
+		}
+	}
+	errors := cfg.convertToAPIParams()
+	policy, policyErrors := newPassPolicy(cfg)
+	errors = append(errors, policyErrors...)
+	selection, selectionErrors := newTestCaseSelection(cfg)
+	errors = append(errors, selectionErrors...)
+	shard, shardErrors := newShardConfig(cfg)
+	errors = append(errors, shardErrors...)
+	for i := range matrixCfgs {
+		for _, err := range matrixCfgs[i].convertToAPIParams() {
+			errors = append(errors, fmt.Errorf("%s: %s", matrixNames[i], err))
+		}
+	}
+	if len(errors) == 0 {
+		// Detected app information is also an output
+		useOutputSinks(cfg)
+		if len(matrixCfgs) == 0 {
+			errors = cfg.validateAndDetect()
+		}
+		for i := range matrixCfgs {
+			for _, err := range matrixCfgs[i].validateAndDetect() {
+				errors = append(errors, fmt.Errorf("%s: %s", matrixNames[i], err))
+			}
+		}
+	}
+	if len(errors) != 0 {
+		for i := range errors {
+			log.Errorf("- %s", errors[i].Error())
+		}
+		os.Exit(1)
+	}
+
+	stepconf.Print(cfg)
+	fmt.Println()
+
+	if err := os.Unsetenv("magic_pod_api_token"); err != nil {
+		failf("Failed to remove API key data from envs, error: %s", err)
+	}
+	if err := os.Unsetenv("external_service_token"); err != nil {
+		failf("Failed to remove external service API key data from envs, error: %s", err)
+	}
+	if err := os.Unsetenv("external_service_password"); err != nil {
+		failf("Failed to remove external service password key data from envs, error: %s", err)
+	}
+
+	if cfg.DryRun {
+		dryRun(cfg, matrixCfgs, matrixNames)
+	}
+
+	client := createClient(cfg)
+	canceller := &batchRunCanceller{client: client, enabled: cfg.CancelOnAbort}
+	trapAbortSignals(canceller)
+
+	if cfg.Mode == "wait" {
+		waitStartedBatchRuns(cfg, client, canceller, policy)
+	}
+
+	if cfg.RerunFailedFrom != "" {
+		numbers, source, err := rerunTestCaseNumbers(cfg, client)
+		if err != nil {
+			failf("Failed to get failed test cases to rerun, error: %s", err)
+		}
+		if len(numbers) == 0 {
+			log.Successf("Exit this step because no test case failed in batch run #%d", source.BatchRunNumber)
+			os.Exit(0)
+		}
+		log.Infof("Rerun %d failed and unresolved test cases of batch run #%d: %s",
+			len(numbers), source.BatchRunNumber, joinNumbers(numbers))
+		cfg.TestCaseNumbersList = numbers
+		for i := range matrixCfgs {
+			matrixCfgs[i].TestCaseNumbersList = numbers
+		}
+	}
+
+	if selection.enabled() {
+		testCases, err := selection.resolve(client)
+		if err != nil {
+			failf("Failed to select test cases, error: %s", err)
+		}
+		logSelectedTestCases(testCases)
+		numbers := testCaseNumbersOf(testCases)
+		cfg.TestCaseNumbersList = numbers
+		for i := range matrixCfgs {
+			matrixCfgs[i].TestCaseNumbersList = numbers
+		}
+	}
+
+	if shard.enabled() {
+		log.Infof("Split test cases into %d shards by %s", shard.count, shard.strategy)
+		numbers, err := shard.testCaseNumbers(client, cfg.TestCaseNumbersList)
+		if err != nil {
+			failf("Failed to split test cases into shards, error: %s", err)
+		}
+		cfg.TestCaseNumbersList = numbers
+		for i := range matrixCfgs {
+			matrixCfgs[i].TestCaseNumbersList = numbers
+		}
+		if len(numbers) == 0 {
+			exportResultJSON(cfg, "skipped", passDecision{true, "no test case is assigned to " + shard.String()}, nil)
+			log.Successf("Exit this step because no test case is assigned to %s", shard)
+			os.Exit(0)
+		}
+		log.Infof("Execute %d test cases of %s: %s", len(numbers), shard, joinNumbers(numbers))
+		fmt.Println()
+	}
+
+	if len(matrixCfgs) != 0 {
+		runDeviceMatrix(cfg, matrixCfgs, matrixNames, client, canceller, policy)
+	}
+
+	// Reattach to the batch run started by the previous attempt of this step or this build,
+	// otherwise upload app file if necessary and post request to start batch run
+	cfg.hashApp()
+	appFileNumber := -1
+	batchRun, started := findStartedBatchRun(cfg, client)
+	startedAt := time.Now()
+	if batchRun != nil {
+		appFileNumber, startedAt = started.AppFileNumber, started.StartedAt
+		log.Donef("Reattached to batch run #%d (%s) started by the previous attempt of this step. You can check detail progress on %s\n",
+			batchRun.BatchRunNumber, batchRun.Status, batchRun.URL)
+	} else {
+		if cfg.AppType == "app_file" {
+			fileNumber, err := uploadAppFile(cfg, client)
+			if err != nil {
+				failf(err.Error())
+			}
+			appFileNumber = fileNumber
+		}
+		startedAt = time.Now()
+		var err error
+		batchRun, err = startBatchRun(cfg, client, appFileNumber)
+		if err != nil {
+			failf(err.Error())
+		}
+		log.Donef("Batch run #%d has started. You can check detail progress on %s\n",
+			batchRun.BatchRunNumber, batchRun.URL)
+	}
+	canceller.addBatchRunNumber(batchRun.BatchRunNumber)
+	exportOutput(outputTestURL, batchRun.URL)
+	exportOutput(outputBatchRunNumber, strconv.Itoa(batchRun.BatchRunNumber))
+
+	if !cfg.WaitForResult {
+		log.Successf("Exit this step without waiting for the result because 'Mode' is start")
+		os.Exit(0)
+	}
+
+	// Wait for test finished
+	log.Infof("Waiting for the test result ...")
+	batchRun = waitBatchRun(cfg, client, canceller, batchRun, startedAt)
+	if cfg.AutoRerunFailed && !policy.decide(batchRun).passed {
+		batchRun = rerunFailedTestCases(cfg, client, canceller, appFileNumber, batchRun)
+	}
+
+	reportBatchRun(cfg, client, policy, batchRun, startedAt)
+}
+
+// Shows and exports the result of the finished batch run, and fails the step by the pass policy.
+// startedAt is zero when the batch run was started by another step
+func reportBatchRun(cfg Config, client *magicpod.Client, policy *passPolicy, batchRun *magicpod.BatchRun, startedAt time.Time) {
+	testCases := batchRun.TestCases
+	message := fmt.Sprintf("\nMagic Pod test %s: \n"+
+		"\tSucceeded : %d\n"+
+		"\tFailed : %d\n"+
+		"\tUnresolved : %d\n"+
+		"\tTotal : %d\n"+
+		"Please see %s for detail",
+		batchRun.Status, testCases.Succeeded, testCases.Failed, testCases.Unresolved, testCases.Total, batchRun.URL)
+	exportOutput(outputTestStatus, batchRun.Status)
+	exportTestCounts(testCases)
+	exportFailedTestCaseNumbers(batchRun)
+	decision := policy.decide(batchRun)
+	// The decision is already made here, so the reports, artifacts and outputs below only warn when they fail.
+	// Failing the step for them would hide the actual test result. The device matrix follows the same rule
+	exportResultJSON(cfg, batchRun.Status, decision, []*deviceRun{
+		{cfg: cfg, batchRun: batchRun, status: batchRun.Status, decision: decision, startedAt: startedAt, finishedAt: time.Now()},
+	})
+	exportPaths(outputJUnitXMLPath, []string{saveTestReport(cfg, batchRun)})
+	exportPaths(outputArtifactsDir, []string{downloadArtifacts(cfg, client, batchRun)})
+	exportDecision(decision)
+	// Failed test cases are shown even when the pass policy allows them
+	printFailedTestCases(batchRun)
+	if !decision.passed {
+		failf(message)
+	}
+	log.Successf(message)
+}
@@ -0,0 +1,151 @@
+package step
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Ranges larger than this are treated as a typo like `1-1000000`
+const maxTestCaseNumberRange = 10000
+
+// Position in `test_case_numbers` input or in a file referred by `@path`, used for error messages
+type testCaseNumberSource struct {
+	name      string // file path, or empty for the input itself
+	multiline bool
+}
+
+func (source testCaseNumberSource) position(line, column int) string {
+	switch {
+	case source.name != "":
+		return fmt.Sprintf("%s:%d:%d", source.name, line, column)
+	case source.multiline:
+		return fmt.Sprintf("line %d, column %d", line, column)
+	default:
+		return fmt.Sprintf("column %d", column)
+	}
+}
+
+// Test case numbers and exclusions in the order of appearance
+type testCaseNumberList struct {
+	included []int
+	excluded map[int]bool
+}
+
+// Converts test case numbers separated by comma or newline. Duplicated numbers are executed only once,
+// in the order of their first appearance. Each item is either of
+//   - a number like `7`
+//   - an inclusive range like `1-20`
+//   - an exclusion of a number or a range like `!7` or `!10-12`, which applies regardless of its position
+//   - `@path/to/file` to read items from the file, where `#` starts a comment until the end of the line
+func convertTestCaseNumber(input string) ([]int, error) {
+	list := &testCaseNumberList{excluded: map[int]bool{}}
+	source := testCaseNumberSource{multiline: strings.Contains(strings.TrimSpace(input), "\n")}
+	if err := list.parse(input, source); err != nil {
+		return []int{}, err
+	}
+	if len(list.included) == 0 && len(list.excluded) != 0 {
+		return []int{}, fmt.Errorf("TestCaseNumber has only exclusions. Please specify the test cases to be executed too")
+	}
+
+	result := []int{}
+	seen := map[int]bool{}
+	for _, number := range list.included {
+		if seen[number] || list.excluded[number] {
+			continue
+		}
+		seen[number] = true
+		result = append(result, number)
+	}
+	if len(result) == 0 && len(list.included) != 0 {
+		return []int{}, fmt.Errorf("TestCaseNumber excludes all the specified test cases")
+	}
+	return result, nil
+}
+
+func (list *testCaseNumberList) parse(input string, source testCaseNumberSource) error {
+	for lineIndex, line := range strings.Split(input, "\n") {
+		if source.name != "" {
+			if comment := strings.Index(line, "#"); comment >= 0 {
+				line = line[:comment]
+			}
+		}
+		offset := 0
+		for _, item := range strings.Split(line, ",") {
+			column := offset + len(item) - len(strings.TrimLeft(item, " \t\r")) + 1
+			offset += len(item) + 1
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			if err := list.parseItem(item, source, lineIndex+1, column); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (list *testCaseNumberList) parseItem(item string, source testCaseNumberSource, line, column int) error {
+	if strings.HasPrefix(item, "@") {
+		path := strings.TrimSpace(item[1:])
+		switch {
+		case source.name != "":
+			return fmt.Errorf("TestCaseNumber %s at %s: files cannot refer to other files", item, source.position(line, column))
+		case path == "":
+			return fmt.Errorf("TestCaseNumber %s at %s should be followed by a file path", item, source.position(line, column))
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("TestCaseNumber %s at %s: failed to read the file, error: %s", item, source.position(line, column), err)
+		}
+		return list.parse(string(content), testCaseNumberSource{name: path})
+	}
+
+	exclude := strings.HasPrefix(item, "!")
+	body := item
+	bodyColumn := column
+	if exclude {
+		body = strings.TrimLeft(item[1:], " \t")
+		bodyColumn += len(item) - len(body)
+	}
+	first, last := body, body
+	lastColumn := bodyColumn
+	if dash := strings.Index(body, "-"); dash > 0 {
+		first = strings.TrimSpace(body[:dash])
+		last = strings.TrimLeft(body[dash+1:], " \t")
+		lastColumn += len(body) - len(last)
+	}
+	firstNumber, err := parseTestCaseNumber(first)
+	if err != nil {
+		return fmt.Errorf("TestCaseNumber %s at %s: %s", item, source.position(line, bodyColumn), err)
+	}
+	lastNumber, err := parseTestCaseNumber(last)
+	if err != nil {
+		return fmt.Errorf("TestCaseNumber %s at %s: %s", item, source.position(line, lastColumn), err)
+	}
+	switch {
+	case lastNumber < firstNumber:
+		return fmt.Errorf("TestCaseNumber %s at %s: range should be in ascending order", item, source.position(line, bodyColumn))
+	case lastNumber-firstNumber >= maxTestCaseNumberRange:
+		return fmt.Errorf("TestCaseNumber %s at %s: range should contain at most %d numbers",
+			item, source.position(line, bodyColumn), maxTestCaseNumberRange)
+	}
+	for number := firstNumber; number <= lastNumber; number++ {
+		if exclude {
+			list.excluded[number] = true
+		} else {
+			list.included = append(list.included, number)
+		}
+	}
+	return nil
+}
+
+func parseTestCaseNumber(str string) (int, error) {
+	number, err := strconv.Atoi(str)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("%q should be a positive integer", str)
+	}
+	return number, nil
+}
@@ -0,0 +1,85 @@
+package step
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConvertTestCaseNumber(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"numbers.txt": "# smoke tests\n1-3\n\n5, 8 # login\n!2\n",
+		"nested.txt":  "1\n@numbers.txt\n",
+		"broken.txt":  "1\n2,\n  3-x\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// {dir} in the inputs and errors is replaced with the directory of the files
+	tests := []struct {
+		input string
+		want  []int
+		err   string
+	}{
+		{"", []int{}, ""},
+		{" \n ", []int{}, ""},
+		{"3,1,2", []int{3, 1, 2}, ""},
+		{" 3 , 1 ,, 2 ,", []int{3, 1, 2}, ""},
+		{"3\n1\r\n2", []int{3, 1, 2}, ""},
+		{"1-3", []int{1, 2, 3}, ""},
+		{"5 - 7, 1", []int{5, 6, 7, 1}, ""},
+		{"4,1-5,2", []int{4, 1, 2, 3, 5}, ""},
+		{"1-5,!2,!4", []int{1, 3, 5}, ""},
+		{"!2-3,1-5", []int{1, 4, 5}, ""},
+		{"! 3, 1-5", []int{1, 2, 4, 5}, ""},
+		{"@{dir}/numbers.txt", []int{1, 3, 5, 8}, ""},
+		{"9, @{dir}/numbers.txt, !8", []int{9, 1, 3, 5}, ""},
+
+		{"1,x", nil, `TestCaseNumber x at column 3: "x" should be a positive integer`},
+		{"1, 0", nil, `TestCaseNumber 0 at column 4: "0" should be a positive integer`},
+		{"-1", nil, `TestCaseNumber -1 at column 1: "-1" should be a positive integer`},
+		{"1,\n  2-x", nil, `TestCaseNumber 2-x at line 2, column 5: "x" should be a positive integer`},
+		{"1, !y", nil, `TestCaseNumber !y at column 5: "y" should be a positive integer`},
+		{"5-3", nil, "TestCaseNumber 5-3 at column 1: range should be in ascending order"},
+		{"1-10001", nil, "TestCaseNumber 1-10001 at column 1: range should contain at most 10000 numbers"},
+		{"!1,!2", nil, "TestCaseNumber has only exclusions"},
+		{"1-3,!1-3", nil, "TestCaseNumber excludes all the specified test cases"},
+		{"@", nil, "TestCaseNumber @ at column 1 should be followed by a file path"},
+		{"1, @{dir}/missing.txt", nil, "TestCaseNumber @{dir}/missing.txt at column 4: failed to read the file"},
+		{"@{dir}/broken.txt", nil, `TestCaseNumber 3-x at {dir}/broken.txt:3:5: "x" should be a positive integer`},
+		{"@{dir}/nested.txt", nil, "TestCaseNumber @numbers.txt at {dir}/nested.txt:2:1: files cannot refer to other files"},
+	}
+	for _, test := range tests {
+		input := strings.Replace(test.input, "{dir}", dir, -1)
+		got, err := convertTestCaseNumber(input)
+		if test.err != "" {
+			want := strings.Replace(test.err, "{dir}", dir, -1)
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("convertTestCaseNumber(%q) error = %v, want %q", input, err, want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("convertTestCaseNumber(%q) error = %v", input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("convertTestCaseNumber(%q) = %v, want %v", input, got, test.want)
+		}
+	}
+}
+
+func TestConvertTestCaseNumberLargestRange(t *testing.T) {
+	got, err := convertTestCaseNumber("1-10000")
+	if err != nil {
+		t.Fatalf("convertTestCaseNumber() error = %v", err)
+	}
+	if len(got) != maxTestCaseNumberRange || got[0] != 1 || got[len(got)-1] != maxTestCaseNumberRange {
+		t.Errorf("convertTestCaseNumber() = %d numbers from %d to %d", len(got), got[0], got[len(got)-1])
+	}
+}
@@ -0,0 +1,60 @@
+package step
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+// Writes JUnit XML of the finished batch run with test-info.json into `test_result_dir`, which is the layout
+// Bitrise Test Reports expects (https://devcenter.bitrise.io/testing/exporting-to-test-reports-from-custom-script-steps/).
+// Returns the path of JUnit XML, or empty when it is not written
+func saveTestReport(cfg Config, batchRun *magicpod.BatchRun) string {
+	if cfg.TestResultDir == "" {
+		return ""
+	}
+	xmlPath, err := writeTestReport(cfg.TestResultDir, batchRun)
+	if err != nil {
+		log.Warnf("Failed to export test report, error: %s", err)
+		return ""
+	}
+	log.Donef("Test report is exported to %s", xmlPath)
+	return xmlPath
+}
+
+func writeTestReport(testResultDir string, batchRun *magicpod.BatchRun) (string, error) {
+	reportDir := filepath.Join(testResultDir, fmt.Sprintf("magicpod-batch-run-%d", batchRun.BatchRunNumber))
+	if err := os.MkdirAll(reportDir, 0755); err != nil {
+		return "", err
+	}
+
+	xmlPath := filepath.Join(reportDir, "magicpod.xml")
+	xmlFile, err := os.Create(xmlPath)
+	if err != nil {
+		return "", err
+	}
+	if err := magicpod.WriteJUnitXML(xmlFile, batchRun); err != nil {
+		xmlFile.Close()
+		return "", err
+	}
+	// Writing is only completed by closing, so its error is not ignored
+	if err := xmlFile.Close(); err != nil {
+		return "", err
+	}
+
+	testInfo, err := json.Marshal(map[string]string{
+		"test-name": fmt.Sprintf("Magic Pod batch run #%d", batchRun.BatchRunNumber),
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(filepath.Join(reportDir, "test-info.json"), testInfo, 0644); err != nil {
+		return "", err
+	}
+	return xmlPath, nil
+}
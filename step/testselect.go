@@ -0,0 +1,172 @@
+package step
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+// Patterns of one kind of `test_case_names`, `test_case_folders` and `test_case_labels`
+type testCasePatterns struct {
+	includes []*regexp.Regexp
+	excludes []*regexp.Regexp
+	values   func(testCase magicpod.TestCase) []string
+}
+
+// Selects test cases by their names, folders and labels instead of numbers.
+// A test case is selected when it matches any of the included patterns of each kind, and none of the excluded ones
+type testCaseSelection struct {
+	patterns []testCasePatterns
+}
+
+func newTestCaseSelection(cfg Config) (*testCaseSelection, []error) {
+	errors := []error{}
+	selection := &testCaseSelection{}
+	kinds := []struct {
+		title  string
+		input  string
+		values func(testCase magicpod.TestCase) []string
+	}{
+		{"Test case names", cfg.TestCaseNames, func(testCase magicpod.TestCase) []string { return []string{testCase.Name} }},
+		{"Test case folders", cfg.TestCaseFolders, folderAndParents},
+		{"Test case labels", cfg.TestCaseLabels, func(testCase magicpod.TestCase) []string { return testCase.Labels }},
+	}
+	for _, kind := range kinds {
+		patterns := testCasePatterns{values: kind.values}
+		for _, line := range strings.Split(kind.input, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			exclude := strings.HasPrefix(line, "!")
+			pattern, err := compileTestCasePattern(strings.TrimSpace(strings.TrimPrefix(line, "!")))
+			if err != nil {
+				errors = append(errors, fmt.Errorf("%s: %s", kind.title, err))
+				continue
+			}
+			if exclude {
+				patterns.excludes = append(patterns.excludes, pattern)
+			} else {
+				patterns.includes = append(patterns.includes, pattern)
+			}
+		}
+		if len(patterns.includes)+len(patterns.excludes) != 0 {
+			selection.patterns = append(selection.patterns, patterns)
+		}
+	}
+	return selection, errors
+}
+
+// Compiles `/regex/` as a regular expression, and others as a glob where `*` matches any characters
+// and `?` matches one character. Both of them should match the whole value
+func compileTestCasePattern(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		if _, err := regexp.Compile(pattern[1 : len(pattern)-1]); err != nil {
+			return nil, fmt.Errorf("invalid regular expression %s: %s", pattern, err)
+		}
+		return regexp.Compile("^(?:" + pattern[1:len(pattern)-1] + ")$")
+	}
+	if pattern == "" || pattern == "/" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// Folder `A/B` of a test case is matched by both `A/B` and `A`
+func folderAndParents(testCase magicpod.TestCase) []string {
+	folders := []string{}
+	segments := strings.Split(strings.Trim(testCase.Folder, "/"), "/")
+	for i := range segments {
+		if folder := strings.Join(segments[:i+1], "/"); folder != "" {
+			folders = append(folders, folder)
+		}
+	}
+	return folders
+}
+
+func matchesAny(patterns []*regexp.Regexp, values []string) bool {
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if pattern.MatchString(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (selection *testCaseSelection) enabled() bool {
+	return len(selection.patterns) != 0
+}
+
+func (selection *testCaseSelection) matches(testCase magicpod.TestCase) bool {
+	for _, patterns := range selection.patterns {
+		values := patterns.values(testCase)
+		if len(patterns.includes) != 0 && !matchesAny(patterns.includes, values) {
+			return false
+		}
+		if matchesAny(patterns.excludes, values) {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolves the selection into test cases of the project, sorted by their numbers
+func (selection *testCaseSelection) resolve(client *magicpod.Client) ([]magicpod.TestCase, error) {
+	testCases, err := client.ListTestCases()
+	if err != nil {
+		return nil, err
+	}
+	selected := []magicpod.TestCase{}
+	for _, testCase := range testCases {
+		if selection.matches(testCase) {
+			selected = append(selected, testCase)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no test case matches among %d test cases of the project", len(testCases))
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Number < selected[j].Number })
+	return selected, nil
+}
+
+func logSelectedTestCases(testCases []magicpod.TestCase) {
+	log.Infof("%d test cases are selected:", len(testCases))
+	for _, testCase := range testCases {
+		line := fmt.Sprintf("- #%d %s", testCase.Number, testCase.Name)
+		if testCase.Folder != "" {
+			line += fmt.Sprintf(" (%s)", testCase.Folder)
+		}
+		if len(testCase.Labels) != 0 {
+			line += fmt.Sprintf(" [%s]", strings.Join(testCase.Labels, ", "))
+		}
+		log.Printf("%s", line)
+	}
+	fmt.Println()
+}
+
+func testCaseNumbersOf(testCases []magicpod.TestCase) []int {
+	numbers := make([]int, len(testCases))
+	for i, testCase := range testCases {
+		numbers[i] = testCase.Number
+	}
+	return numbers
+}
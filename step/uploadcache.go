@@ -0,0 +1,179 @@
+package step
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bitrise-io/go-utils/log"
+	"github.com/magic-Pod/bitrise-step-magicpod-uitest/magicpod"
+)
+
+const uploadCacheFileName = "magicpod-uploaded-files.json"
+
+// Entry of the upload cache, which remembers the file number of the app uploaded before
+type uploadCacheEntry struct {
+	FileNo     int       `json:"file_no"`
+	FileName   string    `json:"file_name"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// Upload cache file in `upload_cache_dir`. Entries are keyed by project and SHA-256 of the app contents
+type uploadCache struct {
+	path    string
+	Entries map[string]uploadCacheEntry `json:"entries"`
+}
+
+func loadUploadCache(dir string) *uploadCache {
+	cache := &uploadCache{path: filepath.Join(dir, uploadCacheFileName), Entries: map[string]uploadCacheEntry{}}
+	data, err := ioutil.ReadFile(cache.path)
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, cache); err != nil {
+		log.Warnf("Ignore broken upload cache %s, error: %s", cache.path, err)
+		cache.Entries = map[string]uploadCacheEntry{}
+	}
+	return cache
+}
+
+// Saves the cache and adds it to the paths pushed by Bitrise Cache:Push step when the outputs go to envman
+func (cache *uploadCache) save() error {
+	if err := os.MkdirAll(filepath.Dir(cache.path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(cache.path, data, 0644); err != nil {
+		return err
+	}
+	return addCacheIncludePath(cache.path)
+}
+
+// Adds the path to BITRISE_CACHE_INCLUDE_PATHS, so that it is shared between builds by Cache:Push step.
+// The variable of this process is also updated, because envman only affects the following steps
+func addCacheIncludePath(path string) error {
+	includePaths := os.Getenv("BITRISE_CACHE_INCLUDE_PATHS")
+	if strings.Contains(includePaths, path) {
+		return nil
+	}
+	includePaths += "\n" + path
+	if err := exportEnvmanOnly("BITRISE_CACHE_INCLUDE_PATHS", includePaths); err != nil {
+		return err
+	}
+	return os.Setenv("BITRISE_CACHE_INCLUDE_PATHS", includePaths)
+}
+
+func uploadCacheKey(cfg Config, hash string) string {
+	return cfg.BaseURL + "/" + cfg.OrganizationName + "/" + cfg.ProjectName + "/" + hash
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Hashes the app once for both reattaching and the upload cache, because reading a large app takes time.
+// Failing to hash only disables them, and the upload reports the problem of the app itself
+func (cfg *Config) hashApp() {
+	if cfg.AppType != "app_file" || cfg.AppContentHash != "" || (!cfg.ReattachBatchRun && cfg.UploadCacheDir == "") {
+		return
+	}
+	hash, err := hashAppContents(cfg.AppPath)
+	if err != nil {
+		log.Warnf("Failed to hash %s, so the batch run is not reattached and the upload cache is not used. error: %s", cfg.AppPath, err)
+		return
+	}
+	cfg.AppContentHash = hash
+}
+
+// SHA-256 of the app file, or of the relative paths and contents of all files in the app directory such as .app.
+// Unlike the zip of the directory, it does not depend on modification times, so the same build has the same hash
+func hashAppContents(path string) (string, error) {
+	path = strings.TrimRight(path, "/")
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return hashFile(path)
+	}
+	hash := sha256.New()
+	// Walk visits the files in lexical order
+	err = filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(path, filePath)
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "link %s %s\x00", filepath.ToSlash(relPath), target)
+		case info.IsDir():
+			fmt.Fprintf(hash, "dir %s\x00", filepath.ToSlash(relPath))
+		default:
+			fmt.Fprintf(hash, "file %s %o %d\x00", filepath.ToSlash(relPath), info.Mode().Perm(), info.Size())
+			file, err := os.Open(filePath)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			if _, err := io.Copy(hash, file); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Returns the file number of the identical app uploaded before if it is still available on Magic Pod, or 0
+func findUploadedFile(cfg Config, client *magicpod.Client, cache *uploadCache, hash string) int {
+	entry, ok := cache.Entries[uploadCacheKey(cfg, hash)]
+	if !ok {
+		return 0
+	}
+	if _, err := client.GetUploadFile(entry.FileNo); err != nil {
+		log.Printf("Uploaded file #%d is not available anymore: %s", entry.FileNo, err)
+		delete(cache.Entries, uploadCacheKey(cfg, hash))
+		return 0
+	}
+	return entry.FileNo
+}
+
+func rememberUploadedFile(cfg Config, cache *uploadCache, hash string, uploadFile *magicpod.UploadFile) {
+	cache.Entries[uploadCacheKey(cfg, hash)] = uploadCacheEntry{
+		FileNo:     uploadFile.FileNo,
+		FileName:   uploadFile.FileName,
+		UploadedAt: time.Now(),
+	}
+	if err := cache.save(); err != nil {
+		log.Warnf("Failed to save upload cache, error: %s", err)
+	}
+}
@@ -0,0 +1,53 @@
+package step
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHashAppContents(t *testing.T) {
+	dir := t.TempDir()
+	appPath := filepath.Join(dir, "Example.app")
+	files := map[string]string{"Info.plist": "plist", "Example": "binary", "Frameworks/A.framework/A": "framework"}
+	for name, content := range files {
+		path := filepath.Join(appPath, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash, err := hashAppContents(appPath)
+	if err != nil {
+		t.Fatalf("hashAppContents() error = %v", err)
+	}
+	if again, _ := hashAppContents(appPath + "/"); again != hash {
+		t.Errorf("hashAppContents() = %s with the trailing slash, want %s", again, hash)
+	}
+
+	// Rebuilding the same app only changes modification times
+	later := time.Now().Add(time.Hour)
+	for name := range files {
+		if err := os.Chtimes(filepath.Join(appPath, name), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if touched, _ := hashAppContents(appPath); touched != hash {
+		t.Errorf("hashAppContents() = %s after touching the files, want %s", touched, hash)
+	}
+
+	if err := os.Rename(filepath.Join(appPath, "Example"), filepath.Join(appPath, "Renamed")); err != nil {
+		t.Fatal(err)
+	}
+	if renamed, _ := hashAppContents(appPath); renamed == hash {
+		t.Error("hashAppContents() does not change when a file is renamed")
+	}
+
+	if _, err := hashAppContents(filepath.Join(dir, "Missing.app")); err == nil {
+		t.Error("hashAppContents() error = nil for the missing app")
+	}
+}
@@ -0,0 +1,177 @@
+package step
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Input which is required only under some conditions, so cannot be marked as `required` in step.yml
+type conditionalInput struct {
+	title string
+	value func(cfg Config) string
+}
+
+// Inputs required when the condition is met
+type requirementRule struct {
+	condition string
+	applies   func(cfg Config) bool
+	required  []conditionalInput
+}
+
+// Combination of inputs which cannot be used together
+type conflictRule struct {
+	message  string
+	conflict func(cfg Config) bool
+}
+
+var (
+	externalServiceTokenInput     = conditionalInput{"External service token", func(cfg Config) string { return string(cfg.ExternalServiceToken) }}
+	externalServiceServerURLInput = conditionalInput{"External service server url", func(cfg Config) string { return cfg.ExternalServiceServerURL }}
+	externalServiceUserNameInput  = conditionalInput{"External service user name", func(cfg Config) string { return cfg.ExternalServiceUserName }}
+	externalServicePasswordInput  = conditionalInput{"External service password", func(cfg Config) string { return string(cfg.ExternalServicePassword) }}
+	appPathInput                  = conditionalInput{"App path", func(cfg Config) string { return cfg.AppPath }}
+	appURLInput                   = conditionalInput{"App URL", func(cfg Config) string { return cfg.AppURL }}
+	bundleIDInput                 = conditionalInput{"Bundle ID", func(cfg Config) string { return cfg.BundleID }}
+	appPackageInput               = conditionalInput{"App package", func(cfg Config) string { return cfg.AppPackage }}
+	appActivityInput              = conditionalInput{"App activity", func(cfg Config) string { return cfg.AppActivity }}
+	batchRunNumbersInput          = conditionalInput{"Batch run numbers", func(cfg Config) string { return cfg.BatchRunNumbers }}
+)
+
+// Same rules as described in step.yml. They are for starting batch runs, so are not applied in wait mode
+var requirementRules = []requirementRule{
+	{
+		condition: "Environment is Remote TestKit",
+		applies:   func(cfg Config) bool { return cfg.Environment == "remote_testkit" },
+		required:  []conditionalInput{externalServiceTokenInput},
+	},
+	{
+		condition: "Environment is Remote TestKit Onpremise",
+		applies:   func(cfg Config) bool { return cfg.Environment == "remote_testkit_onpremise" },
+		required:  []conditionalInput{externalServiceServerURLInput, externalServiceUserNameInput, externalServicePasswordInput},
+	},
+	{
+		condition: "App type is App file (cloud upload)",
+		applies:   func(cfg Config) bool { return cfg.AppType == "app_file" },
+		required:  []conditionalInput{appPathInput},
+	},
+	{
+		condition: "App type is App file (URL)",
+		applies:   func(cfg Config) bool { return cfg.AppType == "app_url" },
+		required:  []conditionalInput{appURLInput},
+	},
+	{
+		condition: "OS is iOS and App type is Installed app",
+		applies:   func(cfg Config) bool { return cfg.OsName == "ios" && cfg.AppType == "installed" },
+		required:  []conditionalInput{bundleIDInput},
+	},
+	{
+		condition: "OS is iOS and Environment is Remote TestKit or Remote TestKit Onpremise",
+		applies: func(cfg Config) bool {
+			return cfg.OsName == "ios" && cfg.AppType != "installed" &&
+				(cfg.Environment == "remote_testkit" || cfg.Environment == "remote_testkit_onpremise")
+		},
+		required: []conditionalInput{bundleIDInput},
+	},
+	{
+		condition: "OS is Android and App type is Installed app",
+		applies:   func(cfg Config) bool { return cfg.OsName == "android" && cfg.AppType == "installed" },
+		required:  []conditionalInput{appPackageInput, appActivityInput},
+	},
+}
+
+var waitModeRequirementRules = []requirementRule{
+	{
+		condition: "Mode is wait",
+		applies:   func(cfg Config) bool { return true },
+		required:  []conditionalInput{batchRunNumbersInput},
+	},
+}
+
+var conflictRules = []conflictRule{
+	{
+		message: "Test case numbers and Rerun failed from cannot be specified at the same time",
+		conflict: func(cfg Config) bool {
+			return cfg.RerunFailedFrom != "" && strings.TrimSpace(cfg.TestCaseNumbers) != ""
+		},
+	},
+	{
+		message: "Test case names, folders and labels cannot be specified with Test case numbers or Rerun failed from",
+		conflict: func(cfg Config) bool {
+			return (strings.TrimSpace(cfg.TestCaseNames) != "" || strings.TrimSpace(cfg.TestCaseFolders) != "" ||
+				strings.TrimSpace(cfg.TestCaseLabels) != "") &&
+				(cfg.RerunFailedFrom != "" || strings.TrimSpace(cfg.TestCaseNumbers) != "")
+		},
+	},
+	{
+		message:  "Auto rerun failed test cases is available only when Mode is start_and_wait",
+		conflict: func(cfg Config) bool { return cfg.AutoRerunFailed && cfg.Mode != "start_and_wait" },
+	},
+	{
+		message:  "Auto rerun failed test cases is not available with Device matrix",
+		conflict: func(cfg Config) bool { return cfg.AutoRerunFailed && cfg.DeviceMatrix != "" },
+	},
+	{
+		message: "Magic Pod cloud supports only Simulator or Emulator for Device type",
+		conflict: func(cfg Config) bool {
+			return cfg.Environment == "magic_pod" && cfg.DeviceType != "simulator" && cfg.DeviceType != "emulator"
+		},
+	},
+	{
+		message: "Remote TestKit and Remote TestKit Onpremise support only Real Device for Device type",
+		conflict: func(cfg Config) bool {
+			return cfg.Environment != "magic_pod" && cfg.DeviceType != "real_device"
+		},
+	},
+	{
+		message:  "Simulator is available only for iOS. Please select Emulator for Android",
+		conflict: func(cfg Config) bool { return cfg.OsName == "android" && cfg.DeviceType == "simulator" },
+	},
+	{
+		message:  "Emulator is available only for Android. Please select Simulator for iOS",
+		conflict: func(cfg Config) bool { return cfg.OsName == "ios" && cfg.DeviceType == "emulator" },
+	},
+}
+
+// Checks the combination of inputs which are already converted to API params, and reports all the problems at once
+func (cfg *Config) validate() []error {
+	errors := []error{}
+	rules := requirementRules
+	if cfg.Mode == "wait" {
+		rules = waitModeRequirementRules
+	}
+	for _, rule := range rules {
+		if !rule.applies(*cfg) {
+			continue
+		}
+		for _, input := range rule.required {
+			if strings.TrimSpace(input.value(*cfg)) == "" {
+				errors = append(errors, fmt.Errorf("%s is required when %s", input.title, rule.condition))
+			}
+		}
+	}
+	for _, rule := range conflictRules {
+		if rule.conflict(*cfg) {
+			errors = append(errors, fmt.Errorf("%s", rule.message))
+		}
+	}
+	return errors
+}
+
+// Validates the app file and fills the inputs detected from it, then validates the combination of inputs.
+// Nothing here calls Magic Pod API, so misconfigurations are reported before uploading
+func (cfg *Config) validateAndDetect() []error {
+	errors := []error{}
+	if cfg.Mode == "wait" {
+		// The app is not used to wait for the batch runs started by another step
+		return cfg.validate()
+	}
+	if err := validateAppFile(*cfg); err != nil {
+		errors = append(errors, err)
+	} else {
+		// Detection failures are only warned. The inputs are not always required,
+		// and cfg.validate() reports the ones which are required but still empty
+		detectBundleID(cfg)
+		detectAndroidApp(cfg)
+	}
+	return append(errors, cfg.validate()...)
+}